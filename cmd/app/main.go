@@ -5,14 +5,19 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
 
 	"social-network/internal/config"
 	"social-network/internal/handler"
+	"social-network/internal/handler/auth"
+	"social-network/internal/mailer"
 	"social-network/internal/repository/postgres"
+	"social-network/internal/security"
 	"social-network/internal/service"
+	"social-network/internal/storage"
 )
 
 func main() {
@@ -31,9 +36,41 @@ func main() {
 
 	repos := postgres.NewRepositories(db)
 
-	services := service.NewServices(repos)
+	hashParams := security.DefaultArgon2Params()
+	hashParams.Memory = uint32(cfg.Argon2Memory)
+	hashParams.Iterations = uint32(cfg.Argon2Iterations)
+	hashParams.Parallelism = uint8(cfg.Argon2Parallelism)
 
-	handlers := handler.NewHandler(services)
+	blobStore := newBlobStore(cfg)
+
+	services := service.NewServices(repos, service.Deps{
+		Mailer:           newMailer(cfg),
+		PasswordHasher:   security.NewArgon2idHasher(hashParams),
+		PasswordResetURL: cfg.PasswordResetURL,
+		TOTPIssuer:       cfg.TOTPIssuer,
+		BlobStore:        blobStore,
+	})
+
+	// Работает на всех экземплярах, публикует только лидер
+	go service.NewPublisher(repos, cfg.PublishInterval).Run()
+	go service.NewMediaJanitor(repos, blobStore).Run()
+	go service.NewTrendAggregator(repos, cfg.TrendsInterval).Run()
+
+	tokenManager := auth.NewTokenManager(repos.Sessions)
+
+	var jwtManager *auth.JWTManager
+	if cfg.AuthTokenType == "jwt" {
+		keys, err := auth.ParseJWTKeys(cfg.JWTKeys)
+		if err != nil {
+			log.Fatalf("Invalid JWT keys: %v", err)
+		}
+		jwtManager, err = auth.NewJWTManager(keys, cfg.JWTActiveKeyID, cfg.JWTAccessTTL, cfg.RefreshTokenTTL, repos.Sessions)
+		if err != nil {
+			log.Fatalf("Could not configure JWT: %v", err)
+		}
+	}
+
+	handlers := handler.NewHandler(services, tokenManager, jwtManager)
 
 	router := mux.NewRouter()
 	handlers.Register(router)
@@ -43,3 +80,31 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+func newMailer(cfg *config.Config) mailer.Mailer {
+	switch cfg.MailDriver {
+	case "smtp":
+		return mailer.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	case "file":
+		f, err := os.OpenFile(cfg.MailFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			log.Fatalf("Could not open mail file: %v", err)
+		}
+		return mailer.NewFileMailer(f, cfg.MailFrom)
+	default:
+		return mailer.NewFileMailer(os.Stdout, cfg.MailFrom)
+	}
+}
+
+func newBlobStore(cfg *config.Config) storage.BlobStore {
+	switch cfg.StorageDriver {
+	case "s3":
+		return storage.NewS3Store(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey)
+	default:
+		store, err := storage.NewLocalStore(cfg.StorageDir)
+		if err != nil {
+			log.Fatalf("Could not open storage: %v", err)
+		}
+		return store
+	}
+}
@@ -3,6 +3,9 @@ module social-network
 go 1.22.1
 
 require (
-	github.com/gorilla/mux v1.8.1 // indirect
-	github.com/lib/pq v1.10.9 // indirect
+	github.com/gorilla/mux v1.8.1
+	github.com/lib/pq v1.10.9
+	golang.org/x/crypto v0.31.0
 )
+
+require golang.org/x/sys v0.28.0 // indirect
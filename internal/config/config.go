@@ -1,6 +1,10 @@
 package config
 
-import "os"
+import (
+    "os"
+    "strconv"
+    "time"
+)
 
 type Config struct {
     DBHost     string
@@ -9,6 +13,44 @@ type Config struct {
     DBPassword string
     DBName     string
     ServerPort string
+
+    // "opaque" - токены сессий, "jwt" - подписанные access-токены + refresh-токены
+    AuthTokenType   string
+    JWTKeys         string
+    JWTActiveKeyID  string
+    JWTAccessTTL    time.Duration
+    RefreshTokenTTL time.Duration
+
+    // "stdout", "file" или "smtp"
+    MailDriver       string
+    MailFile         string
+    MailFrom         string
+    SMTPHost         string
+    SMTPPort         string
+    SMTPUsername     string
+    SMTPPassword     string
+    PasswordResetURL string
+
+    TOTPIssuer string
+
+    Argon2Memory      int
+    Argon2Iterations  int
+    Argon2Parallelism int
+
+    // Как часто publisher проверяет запланированные посты
+    PublishInterval time.Duration
+
+    // Как часто пересчитываются тренды хэштегов
+    TrendsInterval time.Duration
+
+    // "local" - файлы в StorageDir, "s3" - любое S3-совместимое хранилище
+    StorageDriver string
+    StorageDir    string
+    S3Endpoint    string
+    S3Region      string
+    S3Bucket      string
+    S3AccessKey   string
+    S3SecretKey   string
 }
 
 func NewConfig() *Config {
@@ -19,6 +61,39 @@ func NewConfig() *Config {
         DBPassword: getEnv("DB_PASSWORD", "postgres"),
         DBName:     getEnv("DB_NAME", "social_network"),
         ServerPort: getEnv("PORT", "8080"),
+
+        AuthTokenType:   getEnv("AUTH_TOKEN_TYPE", "opaque"),
+        JWTKeys:         getEnv("JWT_KEYS", ""),
+        JWTActiveKeyID:  getEnv("JWT_ACTIVE_KEY_ID", ""),
+        JWTAccessTTL:    getEnvDuration("JWT_ACCESS_TTL", 15*time.Minute),
+        RefreshTokenTTL: getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+
+        MailDriver:       getEnv("MAIL_DRIVER", "stdout"),
+        MailFile:         getEnv("MAIL_FILE", "mail.log"),
+        MailFrom:         getEnv("MAIL_FROM", "noreply@localhost"),
+        SMTPHost:         getEnv("SMTP_HOST", "localhost"),
+        SMTPPort:         getEnv("SMTP_PORT", "25"),
+        SMTPUsername:     getEnv("SMTP_USERNAME", ""),
+        SMTPPassword:     getEnv("SMTP_PASSWORD", ""),
+        PasswordResetURL: getEnv("PASSWORD_RESET_URL", "http://localhost:8080/reset-password"),
+
+        TOTPIssuer: getEnv("TOTP_ISSUER", "Social Network"),
+
+        Argon2Memory:      getEnvInt("ARGON2_MEMORY_KB", 64*1024),
+        Argon2Iterations:  getEnvInt("ARGON2_ITERATIONS", 3),
+        Argon2Parallelism: getEnvInt("ARGON2_PARALLELISM", 2),
+
+        PublishInterval: getEnvDuration("PUBLISH_INTERVAL", 10*time.Second),
+
+        TrendsInterval: getEnvDuration("TRENDS_INTERVAL", 5*time.Minute),
+
+        StorageDriver: getEnv("STORAGE_DRIVER", "local"),
+        StorageDir:    getEnv("STORAGE_DIR", "uploads"),
+        S3Endpoint:    getEnv("S3_ENDPOINT", "http://localhost:9000"),
+        S3Region:      getEnv("S3_REGION", "us-east-1"),
+        S3Bucket:      getEnv("S3_BUCKET", "media"),
+        S3AccessKey:   getEnv("S3_ACCESS_KEY", ""),
+        S3SecretKey:   getEnv("S3_SECRET_KEY", ""),
     }
 }
 
@@ -28,3 +103,17 @@ func getEnv(key, defaultValue string) string {
     }
     return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+    if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+        return value
+    }
+    return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+    if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+        return value
+    }
+    return defaultValue
+}
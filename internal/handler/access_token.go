@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"social-network/internal/models"
+	"social-network/internal/repository/postgres"
+	"social-network/internal/service"
+)
+
+type createAccessTokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// 0 - бессрочный токен
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+type createAccessTokenResponse struct {
+	Token string `json:"token"`
+	*models.PersonalAccessToken
+}
+
+func (h *Handler) createAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var req createAccessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresInDays < 0 {
+		http.Error(w, "expires_in_days must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	ttl := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	raw, token, err := h.services.Tokens.Create(userID, req.Name, req.Scopes, ttl)
+	if err != nil {
+		switch err {
+		case service.ErrInvalidTokenName, service.ErrInvalidScope:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Токен показывается один раз, потом его не узнать
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createAccessTokenResponse{Token: raw, PersonalAccessToken: token})
+}
+
+func (h *Handler) getAccessTokens(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := h.services.Tokens.GetUserTokens(userID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func (h *Handler) revokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	tokenID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid token id", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.services.Tokens.Revoke(userID, tokenID); err != nil {
+		if err == postgres.ErrAccessTokenNotFound {
+			http.Error(w, "token not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -4,15 +4,36 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"log"
+	"math"
+	"net"
 	"net/http"
+	"net/mail"
+	"social-network/internal/handler/auth"
 	"social-network/internal/repository/postgres"
+	"social-network/internal/service"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
 )
 
 type userIDKey struct{}
 
+type sessionIDKey struct{}
+
+// principal - от чьего имени и с какими правами выполняется запрос
+type principal struct {
+	UserID    int
+	SessionID int
+	// nil - полный доступ (вход по паролю), иначе только перечисленные права
+	Scopes []string
+}
+
 type registerRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Email    string `json:"email"`
 }
 
 type loginRequest struct {
@@ -20,25 +41,55 @@ type loginRequest struct {
 	Password string `json:"password" validate:"required"`
 }
 
+type loginTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
 type authResponse struct {
-	Token string `json:"token"`
+	Token             string `json:"token,omitempty"`
+	RefreshToken      string `json:"refresh_token,omitempty"`
+	ExpiresIn         int    `json:"expires_in,omitempty"`
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	ChallengeToken    string `json:"challenge_token,omitempty"`
 }
 
 func (h *Handler) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("Authorization")
+		token := bearerToken(r)
 		if token == "" {
 			http.Error(w, "missing auth token", http.StatusUnauthorized)
 			return
 		}
 
-		userID, err := h.tokenManager.ValidateToken(token)
+		p, err := h.authenticate(token)
 		if err != nil {
 			http.Error(w, "invalid or expired token", http.StatusUnauthorized)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), userIDKey{}, userID)
+		if p.Scopes != nil && !h.routeAllows(r, p.Scopes) {
+			http.Error(w, "insufficient token scope", http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userIDKey{}, p.UserID)
+		if p.SessionID != 0 {
+			ctx = context.WithValue(ctx, sessionIDKey{}, p.SessionID)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -55,7 +106,14 @@ func (h *Handler) register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.services.Users.Register(req.Username, req.Password); err != nil {
+	if req.Email != "" {
+		if _, err := mail.ParseAddress(req.Email); err != nil {
+			http.Error(w, "invalid email", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.services.Users.Register(req.Username, req.Password, req.Email); err != nil {
 		if err == postgres.ErrUserExists {
 			http.Error(w, "username already taken", http.StatusConflict)
 			return
@@ -74,9 +132,25 @@ func (h *Handler) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Проверяем блокировку до дорогой проверки пароля
+	ip := clientIP(r)
+	retryAfter, err := h.services.Lockouts.Check(req.Username, ip)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		http.Error(w, "too many failed login attempts", http.StatusTooManyRequests)
+		return
+	}
+
 	user, err := h.services.Users.ValidateUser(req.Username, req.Password)
 	if err != nil {
 		if err == postgres.ErrUserNotFound {
+			if err := h.services.Lockouts.RegisterFailure(req.Username, ip); err != nil {
+				log.Printf("register login failure: %v", err)
+			}
 			http.Error(w, "invalid credentials", http.StatusUnauthorized)
 			return
 		}
@@ -84,8 +158,69 @@ func (h *Handler) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := h.services.Lockouts.RegisterSuccess(req.Username); err != nil {
+		log.Printf("reset login failures: %v", err)
+	}
+
+	// С включенной 2FA вместо токена выдаем токен второго шага
+	if user.TOTPEnabled {
+		challenge, err := h.services.TwoFactor.BeginLogin(user.ID)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(authResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+		})
+		return
+	}
+
+	h.issueTokens(w, r, user.ID)
+}
+
+func (h *Handler) loginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req loginTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeToken == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := h.services.TwoFactor.CompleteLogin(req.ChallengeToken, req.Code)
+	if err != nil {
+		switch err {
+		case postgres.ErrChallengeNotFound:
+			http.Error(w, "invalid or expired challenge", http.StatusUnauthorized)
+		case service.ErrInvalidTOTPCode:
+			http.Error(w, "invalid code", http.StatusUnauthorized)
+		default:
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.issueTokens(w, r, userID)
+}
+
+// issueTokens открывает сессию и отдает клиенту токен(ы)
+func (h *Handler) issueTokens(w http.ResponseWriter, r *http.Request, userID int) {
+	if h.jwtManager != nil {
+		pair, err := h.jwtManager.IssueTokens(userID, r.UserAgent(), clientIP(r))
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		writeTokenPair(w, pair)
+		return
+	}
+
 	token := h.tokenManager.GenerateToken()
-	h.tokenManager.AddToken(token, user.ID)
+	if err := h.tokenManager.AddToken(token, userID, r.UserAgent(), clientIP(r)); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 
@@ -94,6 +229,159 @@ func (h *Handler) login(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (h *Handler) refresh(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	pair, err := h.jwtManager.Refresh(req.RefreshToken)
+	if err != nil {
+		switch err {
+		case postgres.ErrRefreshTokenReused:
+			log.Printf("refresh token reuse detected from %s, token family revoked", clientIP(r))
+			http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		case postgres.ErrRefreshTokenNotFound:
+			http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		default:
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeTokenPair(w, pair)
+}
+
+func (h *Handler) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req forgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.services.Users.RequestPasswordReset(req.Email); err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Ответ не зависит от того, есть ли такая почта
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *Handler) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.NewPassword) < 6 {
+		http.Error(w, "password too short", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.services.Users.ResetPassword(req.Token, req.NewPassword); err != nil {
+		if err == postgres.ErrInvalidResetToken {
+			http.Error(w, "invalid or expired reset token", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) logout(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	sessionID, err := h.getSessionIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.services.Sessions.Revoke(userID, sessionID); err != nil && err != postgres.ErrSessionNotFound {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// authenticate проверяет персональный токен, токен OAuth-приложения,
+// JWT или непрозрачный токен сессии
+func (h *Handler) authenticate(token string) (*principal, error) {
+	if strings.HasPrefix(token, service.AccessTokenPrefix) {
+		pat, err := h.services.Tokens.Authenticate(token)
+		if err != nil {
+			return nil, err
+		}
+		return &principal{UserID: pat.UserID, Scopes: pat.Scopes}, nil
+	}
+
+	if strings.HasPrefix(token, service.OAuthAccessTokenPrefix) {
+		oauthToken, err := h.services.OAuth.Authenticate(token)
+		if err != nil {
+			return nil, err
+		}
+		return &principal{UserID: oauthToken.UserID, SessionID: oauthToken.SessionID, Scopes: oauthToken.Scopes}, nil
+	}
+
+	if h.jwtManager != nil && auth.IsJWT(token) {
+		claims, err := h.jwtManager.ValidateAccessToken(token)
+		if err != nil {
+			return nil, err
+		}
+		userID, err := claims.UserID()
+		if err != nil {
+			return nil, err
+		}
+		return &principal{UserID: userID, SessionID: claims.SessionID}, nil
+	}
+
+	session, err := h.tokenManager.ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+	return &principal{UserID: session.UserID, SessionID: session.ID}, nil
+}
+
+// routeAllows проверяет право, которое Register назначил текущему маршруту.
+// Маршруты без права доступны только при входе по паролю.
+func (h *Handler) routeAllows(r *http.Request, scopes []string) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+
+	required, ok := h.routeScopes[route]
+	if !ok {
+		return false
+	}
+
+	for _, scope := range scopes {
+		if scope == required {
+			return true
+		}
+	}
+	return false
+}
+
+func writeTokenPair(w http.ResponseWriter, pair *auth.TokenPair) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(authResponse{
+		Token:        pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		ExpiresIn:    pair.ExpiresIn,
+	})
+}
+
 func (*Handler) getUserIDFromContext(r *http.Request) (int, error) {
 	userID, ok := r.Context().Value(userIDKey{}).(int)
 	if !ok {
@@ -101,3 +389,28 @@ func (*Handler) getUserIDFromContext(r *http.Request) (int, error) {
 	}
 	return userID, nil
 }
+
+func (*Handler) getSessionIDFromContext(r *http.Request) (int, error) {
+	sessionID, ok := r.Context().Value(sessionIDKey{}).(int)
+	if !ok {
+		return 0, errors.New("no session id in context")
+	}
+	return sessionID, nil
+}
+
+// bearerToken поддерживает и "Bearer <token>", и голый токен в заголовке
+func bearerToken(r *http.Request) string {
+	token := r.Header.Get("Authorization")
+	if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+		return strings.TrimSpace(token[7:])
+	}
+	return token
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
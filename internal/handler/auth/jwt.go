@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"social-network/internal/models"
+	"social-network/internal/security"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	ErrInvalidJWT   = errors.New("invalid jwt")
+	ErrExpiredJWT   = errors.New("jwt expired")
+	ErrUnknownKeyID = errors.New("unknown jwt key id")
+	ErrRevokedJWT   = errors.New("jwt session revoked")
+)
+
+// JWTKey - ключ подписи. Для HS256 Secret - общий секрет,
+// для EdDSA - 32-байтовый seed приватного ключа ed25519.
+type JWTKey struct {
+	ID        string
+	Algorithm string
+	Secret    []byte
+}
+
+// RefreshTokenStore хранит refresh-токены. Семья токенов - это одна сессия:
+// все токены, полученные ротацией от первого, ссылаются на нее.
+type RefreshTokenStore interface {
+	// CreateFamily создает сессию и первый refresh-токен в ней
+	CreateFamily(session *models.Session, tokenHash string) error
+	// Rotate гасит старый токен и выпускает на его место новый. Повторное
+	// предъявление уже погашенного токена отзывает всю семью.
+	Rotate(oldHash, newHash string, expiresAt time.Time) (*models.Session, error)
+	// IsActive сообщает, что сессия не отозвана и не истекла
+	IsActive(sessionID int) (bool, error)
+}
+
+type Claims struct {
+	Subject   string `json:"sub"`
+	SessionID int    `json:"sid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func (c *Claims) UserID() (int, error) {
+	return strconv.Atoi(c.Subject)
+}
+
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+type JWTManager struct {
+	keys        map[string]JWTKey
+	activeKeyID string
+	accessTTL   time.Duration
+	refreshTTL  time.Duration
+	store       RefreshTokenStore
+}
+
+func NewJWTManager(keys []JWTKey, activeKeyID string, accessTTL, refreshTTL time.Duration, store RefreshTokenStore) (*JWTManager, error) {
+	m := &JWTManager{
+		keys:        make(map[string]JWTKey, len(keys)),
+		activeKeyID: activeKeyID,
+		accessTTL:   accessTTL,
+		refreshTTL:  refreshTTL,
+		store:       store,
+	}
+
+	for _, key := range keys {
+		switch key.Algorithm {
+		case AlgHS256:
+			if len(key.Secret) < 32 {
+				return nil, fmt.Errorf("key %q: HS256 secret must be at least 32 bytes", key.ID)
+			}
+		case AlgEdDSA:
+			if len(key.Secret) != ed25519.SeedSize {
+				return nil, fmt.Errorf("key %q: EdDSA seed must be %d bytes", key.ID, ed25519.SeedSize)
+			}
+		default:
+			return nil, fmt.Errorf("key %q: unsupported algorithm %q", key.ID, key.Algorithm)
+		}
+		m.keys[key.ID] = key
+	}
+
+	if _, ok := m.keys[activeKeyID]; !ok {
+		return nil, fmt.Errorf("active key %q is not configured", activeKeyID)
+	}
+
+	return m, nil
+}
+
+// ParseJWTKeys разбирает список ключей вида "kid:alg:base64,kid:alg:base64"
+func ParseJWTKeys(spec string) ([]JWTKey, error) {
+	var keys []JWTKey
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.SplitN(item, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid jwt key %q", item)
+		}
+
+		secret, err := base64.StdEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("decode jwt key %q: %w", parts[0], err)
+		}
+
+		keys = append(keys, JWTKey{ID: parts[0], Algorithm: parts[1], Secret: secret})
+	}
+	return keys, nil
+}
+
+func (m *JWTManager) IssueTokens(userID int, userAgent, ip string) (*TokenPair, error) {
+	refreshToken := security.GenerateToken()
+	session := &models.Session{
+		UserID:    userID,
+		UserAgent: userAgent,
+		IP:        ip,
+		ExpiresAt: time.Now().Add(m.refreshTTL),
+	}
+	if err := m.store.CreateFamily(session, security.HashToken(refreshToken)); err != nil {
+		return nil, err
+	}
+
+	return m.tokenPair(session, refreshToken)
+}
+
+func (m *JWTManager) Refresh(refreshToken string) (*TokenPair, error) {
+	newToken := security.GenerateToken()
+	session, err := m.store.Rotate(security.HashToken(refreshToken), security.HashToken(newToken), time.Now().Add(m.refreshTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	return m.tokenPair(session, newToken)
+}
+
+func (m *JWTManager) ValidateAccessToken(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidJWT
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidJWT
+	}
+
+	key, ok := m.keys[header.KeyID]
+	if !ok {
+		return nil, ErrUnknownKeyID
+	}
+	// Алгоритм берем из ключа, а не из заголовка
+	if header.Algorithm != key.Algorithm {
+		return nil, ErrInvalidJWT
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidJWT
+	}
+	if !verify(key, []byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrInvalidJWT
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidJWT
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredJWT
+	}
+
+	// Подпись не отзовешь: после выхода, отзыва сессии, смены пароля или
+	// повторного refresh-токена access-токен перестает действовать только
+	// потому, что его сессии больше нет
+	active, err := m.store.IsActive(claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		return nil, ErrRevokedJWT
+	}
+
+	return &claims, nil
+}
+
+// IsJWT отличает JWT от непрозрачного токена сессии
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func (m *JWTManager) tokenPair(session *models.Session, refreshToken string) (*TokenPair, error) {
+	now := time.Now()
+	accessToken, err := m.sign(Claims{
+		Subject:   strconv.Itoa(session.UserID),
+		SessionID: session.ID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(m.accessTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(m.accessTTL.Seconds()),
+	}, nil
+}
+
+func (m *JWTManager) sign(claims Claims) (string, error) {
+	key := m.keys[m.activeKeyID]
+
+	header, err := encodeSegment(jwtHeader{Algorithm: key.Algorithm, Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := encodeSegment(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := header + "." + payload
+	var signature []byte
+	switch key.Algorithm {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, key.Secret)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case AlgEdDSA:
+		signature = ed25519.Sign(ed25519.NewKeyFromSeed(key.Secret), []byte(signingInput))
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func verify(key JWTKey, signingInput, signature []byte) bool {
+	switch key.Algorithm {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, key.Secret)
+		mac.Write(signingInput)
+		return hmac.Equal(mac.Sum(nil), signature)
+	case AlgEdDSA:
+		public := ed25519.NewKeyFromSeed(key.Secret).Public().(ed25519.PublicKey)
+		return ed25519.Verify(public, signingInput, signature)
+	}
+	return false
+}
+
+func encodeSegment(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("encode jwt segment: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
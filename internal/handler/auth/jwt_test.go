@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"errors"
+	"social-network/internal/models"
+	"testing"
+	"time"
+)
+
+var errReused = errors.New("refresh token reused")
+
+type refreshToken struct {
+	sessionID int
+	used      bool
+}
+
+// memoryStore повторяет семантику SessionRepository в памяти
+type memoryStore struct {
+	nextID   int
+	sessions map[int]*models.Session
+	tokens   map[string]*refreshToken
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		sessions: map[int]*models.Session{},
+		tokens:   map[string]*refreshToken{},
+	}
+}
+
+func (s *memoryStore) CreateFamily(session *models.Session, tokenHash string) error {
+	s.nextID++
+	session.ID = s.nextID
+	s.sessions[session.ID] = session
+	s.tokens[tokenHash] = &refreshToken{sessionID: session.ID}
+	return nil
+}
+
+func (s *memoryStore) Rotate(oldHash, newHash string, expiresAt time.Time) (*models.Session, error) {
+	token, ok := s.tokens[oldHash]
+	if !ok {
+		return nil, errors.New("refresh token not found")
+	}
+	if token.used {
+		delete(s.sessions, token.sessionID)
+		return nil, errReused
+	}
+
+	session, ok := s.sessions[token.sessionID]
+	if !ok {
+		return nil, errors.New("refresh token not found")
+	}
+	token.used = true
+	s.tokens[newHash] = &refreshToken{sessionID: session.ID}
+	session.ExpiresAt = expiresAt
+	return session, nil
+}
+
+func (s *memoryStore) IsActive(sessionID int) (bool, error) {
+	session, ok := s.sessions[sessionID]
+	return ok && session.ExpiresAt.After(time.Now()), nil
+}
+
+func newTestManager(t *testing.T, store RefreshTokenStore) *JWTManager {
+	t.Helper()
+	keys := []JWTKey{{ID: "k1", Algorithm: AlgHS256, Secret: []byte("0123456789abcdef0123456789abcdef")}}
+	m, err := NewJWTManager(keys, "k1", 15*time.Minute, time.Hour, store)
+	if err != nil {
+		t.Fatalf("new manager: %v", err)
+	}
+	return m
+}
+
+func TestValidateAccessToken(t *testing.T) {
+	store := newMemoryStore()
+	m := newTestManager(t, store)
+
+	pair, err := m.IssueTokens(7, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("issue tokens: %v", err)
+	}
+
+	claims, err := m.ValidateAccessToken(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if userID, _ := claims.UserID(); userID != 7 {
+		t.Errorf("user id = %d, want 7", userID)
+	}
+
+	tampered := pair.AccessToken[:len(pair.AccessToken)-2] + "xx"
+	if _, err := m.ValidateAccessToken(tampered); err != ErrInvalidJWT {
+		t.Errorf("tampered token: err = %v, want %v", err, ErrInvalidJWT)
+	}
+}
+
+// Повторный refresh-токен отзывает семью, и вместе с ней - уже выданные
+// access-токены, в том числе у того, кто украл токен
+func TestRefreshReuseRevokesAccessTokens(t *testing.T) {
+	store := newMemoryStore()
+	m := newTestManager(t, store)
+
+	first, err := m.IssueTokens(7, "test", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("issue tokens: %v", err)
+	}
+	second, err := m.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if _, err := m.ValidateAccessToken(second.AccessToken); err != nil {
+		t.Fatalf("validate rotated token: %v", err)
+	}
+
+	if _, err := m.Refresh(first.RefreshToken); err != errReused {
+		t.Fatalf("reuse: err = %v, want %v", err, errReused)
+	}
+
+	for name, token := range map[string]string{"first": first.AccessToken, "second": second.AccessToken} {
+		if _, err := m.ValidateAccessToken(token); err != ErrRevokedJWT {
+			t.Errorf("%s access token: err = %v, want %v", name, err, ErrRevokedJWT)
+		}
+	}
+}
@@ -1,85 +1,69 @@
 package auth
 
 import (
-	"crypto/rand"
-	"encoding/hex"
-	"errors"
-	"sync"
+	"log"
+	"social-network/internal/models"
+	"social-network/internal/security"
 	"time"
 )
 
-type tokenData struct {
-	UserID    int
-	ExpiresAt time.Time
+const (
+	tokenTTL        = 30 * time.Minute
+	cleanupInterval = 5 * time.Minute
+)
+
+// SessionStore - хранилище сессий. Токены в него попадают только в виде хэша.
+type SessionStore interface {
+	Create(session *models.Session) error
+	// Touch продлевает живую сессию до expiresAt и возвращает ее
+	Touch(tokenHash string, expiresAt time.Time) (*models.Session, error)
+	DeleteByTokenHash(tokenHash string) error
+	DeleteExpired() (int64, error)
 }
 
 type TokenManager struct {
-	tokens map[string]tokenData
-	mu     sync.RWMutex
+	store SessionStore
 }
 
-func NewTokenManager() *TokenManager {
+func NewTokenManager(store SessionStore) *TokenManager {
 	tm := &TokenManager{
-		tokens: make(map[string]tokenData),
+		store: store,
 	}
 	go tm.startCleanup()
 	return tm
 }
 
-func (tm *TokenManager) AddToken(token string, userID int) {
-	tm.mu.Lock()
-	defer tm.mu.Unlock()
-	tm.tokens[token] = tokenData{
+func (tm *TokenManager) AddToken(token string, userID int, userAgent, ip string) error {
+	return tm.store.Create(&models.Session{
+		TokenHash: security.HashToken(token),
 		UserID:    userID,
-		ExpiresAt: time.Now().Add(30 * time.Minute),
-	}
+		UserAgent: userAgent,
+		IP:        ip,
+		ExpiresAt: time.Now().Add(tokenTTL),
+	})
 }
 
-func (tm *TokenManager) ValidateToken(token string) (int, error) {
-	tm.mu.RLock()
-	data, exists := tm.tokens[token]
-	tm.mu.RUnlock()
-
-	if !exists || time.Now().After(data.ExpiresAt) {
-		return 0, errors.New("invalid token")
-
-	}
-
-	data.ExpiresAt = time.Now().Add(30 * time.Minute)
-	tm.mu.Lock()
-	tm.tokens[token] = data
-	tm.mu.Unlock()
-
-	return data.UserID, nil
+func (tm *TokenManager) ValidateToken(token string) (*models.Session, error) {
+	return tm.store.Touch(security.HashToken(token), time.Now().Add(tokenTTL))
 }
 
 func (tm *TokenManager) startCleanup() {
-	ticker := time.NewTicker(5 * time.Minute)
+	ticker := time.NewTicker(cleanupInterval)
 	for range ticker.C {
 		tm.cleanup()
 	}
 }
 
 func (tm *TokenManager) cleanup() {
-	tm.mu.Lock()
-	defer tm.mu.Unlock()
-
-	now := time.Now()
-	for token, data := range tm.tokens {
-		if now.After(data.ExpiresAt) {
-			delete(tm.tokens, token)
-		}
+	if _, err := tm.store.DeleteExpired(); err != nil {
+		log.Printf("session cleanup: %v", err)
 	}
 }
 
 func (*TokenManager) GenerateToken() string {
-	b := make([]byte, 32)
-	rand.Read(b)
-	return hex.EncodeToString(b)
+	return security.GenerateToken()
 }
 
-func (tm *TokenManager) RemoveToken(token string) {
-	tm.mu.Lock()
-	defer tm.mu.Unlock()
-	delete(tm.tokens, token)
+func (tm *TokenManager) RemoveToken(token string) error {
+	return tm.store.DeleteByTokenHash(security.HashToken(token))
 }
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"social-network/internal/repository/postgres"
+	"social-network/internal/service"
+)
+
+// Тело необязательно: без collection_id закладка не попадает в подборку
+type bookmarkRequest struct {
+	CollectionID *int `json:"collection_id"`
+}
+
+type createCollectionRequest struct {
+	Name string `json:"name"`
+}
+
+func (h *Handler) bookmarkPost(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+
+	var req bookmarkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.services.Bookmarks.Add(postID, userID, req.CollectionID); err != nil {
+		writeBookmarkError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) unbookmarkPost(w http.ResponseWriter, r *http.Request) {
+	h.markPost(w, r, h.services.Bookmarks.Remove)
+}
+
+func (h *Handler) getBookmarks(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var collectionID *int
+	if value := r.URL.Query().Get("collection_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "invalid collection id", http.StatusBadRequest)
+			return
+		}
+		collectionID = &id
+	}
+
+	page, perPage, _ := getPaginationParams(r)
+
+	posts, err := h.services.Bookmarks.GetBookmarks(userID, collectionID, page, perPage)
+	if err != nil {
+		writeBookmarkError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(posts)
+}
+
+func (h *Handler) createBookmarkCollection(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var req createCollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	collection, err := h.services.Bookmarks.CreateCollection(userID, req.Name)
+	if err != nil {
+		writeBookmarkError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(collection)
+}
+
+func (h *Handler) getBookmarkCollections(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	collections, err := h.services.Bookmarks.GetCollections(userID)
+	if err != nil {
+		writeBookmarkError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collections)
+}
+
+func (h *Handler) deleteBookmarkCollection(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	collectionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid collection id", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.services.Bookmarks.DeleteCollection(userID, collectionID); err != nil {
+		writeBookmarkError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeBookmarkError(w http.ResponseWriter, err error) {
+	switch err {
+	case postgres.ErrPostNotFound:
+		http.Error(w, "post not found", http.StatusNotFound)
+	case postgres.ErrCollectionNotFound:
+		http.Error(w, "collection not found", http.StatusNotFound)
+	case service.ErrInvalidCollectionName:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case postgres.ErrCollectionExists:
+		http.Error(w, "collection already exists", http.StatusConflict)
+	case service.ErrPermissionDenied:
+		http.Error(w, "permission denied", http.StatusForbidden)
+	default:
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}
+}
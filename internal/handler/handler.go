@@ -3,6 +3,7 @@ package handler
 import (
 	"net/http"
 	"social-network/internal/handler/auth"
+	"social-network/internal/models"
 	"social-network/internal/service"
 	"strconv"
 
@@ -12,12 +13,18 @@ import (
 type Handler struct {
 	services     *service.Services
 	tokenManager *auth.TokenManager
+	// nil, если выдаются только непрозрачные токены сессий
+	jwtManager *auth.JWTManager
+	// право, которое нужно персональному токену для маршрута
+	routeScopes map[*mux.Route]string
 }
 
-func NewHandler(services *service.Services) *Handler {
+func NewHandler(services *service.Services, tokenManager *auth.TokenManager, jwtManager *auth.JWTManager) *Handler {
 	return &Handler{
 		services:     services,
-		tokenManager: auth.NewTokenManager(),
+		tokenManager: tokenManager,
+		jwtManager:   jwtManager,
+		routeScopes:  make(map[*mux.Route]string),
 	}
 }
 
@@ -26,29 +33,119 @@ func (h *Handler) Register(router *mux.Router) {
 	router.HandleFunc("/auth/register", h.register).Methods("POST")
 	// вход
 	router.HandleFunc("/auth/login", h.login).Methods("POST")
+	router.HandleFunc("/auth/login/2fa", h.loginTwoFactor).Methods("POST")
+	// обновление access-токена
+	if h.jwtManager != nil {
+		router.HandleFunc("/auth/refresh", h.refresh).Methods("POST")
+	}
+	// восстановление пароля
+	router.HandleFunc("/auth/password/forgot", h.forgotPassword).Methods("POST")
+	router.HandleFunc("/auth/password/reset", h.resetPassword).Methods("POST")
+	// выход
+	router.Handle("/auth/logout", h.authMiddleware(http.HandlerFunc(h.logout))).Methods("POST")
+	// OAuth2 для сторонних приложений
+	router.HandleFunc("/oauth/token", h.oauthToken).Methods("POST")
+	router.HandleFunc("/oauth/introspect", h.oauthIntrospect).Methods("POST")
+	router.HandleFunc("/oauth/revoke", h.oauthRevoke).Methods("POST")
+	// загруженные файлы; токен необязателен, см. serveMedia
+	h.scoped(models.ScopePostsRead, router.HandleFunc("/media/{id}", h.getMedia).Methods("GET"))
+	h.scoped(models.ScopePostsRead, router.HandleFunc("/media/{id}/thumbnail", h.getMediaThumbnail).Methods("GET"))
 
 	// ручки
 	api := router.PathPrefix("/api").Subrouter()
 	api.Use(h.authMiddleware)
 
 	// посты
-	api.HandleFunc("/posts", h.createPost).Methods("POST")
-	api.HandleFunc("/posts/my", h.getMyPosts).Methods("GET")
-	api.HandleFunc("/posts/feed", h.getFeed).Methods("GET")
-	api.HandleFunc("/posts/{id}", h.getPost).Methods("GET")
-	api.HandleFunc("/posts/{id}", h.updatePost).Methods("PUT")
-	api.HandleFunc("/posts/{id}", h.deletePost).Methods("DELETE")
-	api.HandleFunc("/posts/hashtag/{hashtag}", h.getPostsByHashtag).Methods("GET")
+	h.scoped(models.ScopePostsWrite, api.HandleFunc("/posts", h.createPost).Methods("POST"))
+	h.scoped(models.ScopePostsWrite, api.HandleFunc("/media", h.uploadMedia).Methods("POST"))
+	h.scoped(models.ScopePostsRead, api.HandleFunc("/posts/my", h.getMyPosts).Methods("GET"))
+	h.scoped(models.ScopePostsRead, api.HandleFunc("/posts/feed", h.getFeed).Methods("GET"))
+	h.scoped(models.ScopePostsRead, api.HandleFunc("/posts/drafts", h.getDrafts).Methods("GET"))
+	h.scoped(models.ScopePostsRead, api.HandleFunc("/mentions", h.getMentions).Methods("GET"))
+	h.scoped(models.ScopePostsRead, api.HandleFunc("/posts/{id}", h.getPost).Methods("GET"))
+	h.scoped(models.ScopePostsWrite, api.HandleFunc("/posts/{id}", h.updatePost).Methods("PUT"))
+	h.scoped(models.ScopePostsWrite, api.HandleFunc("/posts/{id}", h.deletePost).Methods("DELETE"))
+	h.scoped(models.ScopePostsRead, api.HandleFunc("/posts/hashtag/{hashtag}", h.getPostsByHashtag).Methods("GET"))
+	h.scoped(models.ScopePostsRead, api.HandleFunc("/hashtags/trending", h.getTrendingHashtags).Methods("GET"))
+	h.scoped(models.ScopePostsWrite, api.HandleFunc("/posts/{id}/replies", h.createReply).Methods("POST"))
+	h.scoped(models.ScopePostsRead, api.HandleFunc("/posts/{id}/thread", h.getThread).Methods("GET"))
+	h.scoped(models.ScopePostsWrite, api.HandleFunc("/posts/{id}/like", h.likePost).Methods("POST"))
+	h.scoped(models.ScopePostsWrite, api.HandleFunc("/posts/{id}/like", h.unlikePost).Methods("DELETE"))
+	h.scoped(models.ScopePostsRead, api.HandleFunc("/posts/{id}/likes", h.getPostLikers).Methods("GET"))
+	h.scoped(models.ScopePostsWrite, api.HandleFunc("/posts/{id}/repost", h.repostPost).Methods("POST"))
+	h.scoped(models.ScopePostsWrite, api.HandleFunc("/posts/{id}/repost", h.unrepostPost).Methods("DELETE"))
+	h.scoped(models.ScopePostsWrite, api.HandleFunc("/posts/{id}/quote", h.quotePost).Methods("POST"))
+	h.scoped(models.ScopePostsWrite, api.HandleFunc("/posts/{id}/poll/votes", h.votePoll).Methods("POST"))
+	h.scoped(models.ScopePostsWrite, api.HandleFunc("/posts/{id}/bookmark", h.bookmarkPost).Methods("POST"))
+	h.scoped(models.ScopePostsWrite, api.HandleFunc("/posts/{id}/bookmark", h.unbookmarkPost).Methods("DELETE"))
+	h.scoped(models.ScopePostsRead, api.HandleFunc("/posts/{id}/history", h.getPostHistory).Methods("GET"))
+	h.scoped(models.ScopePostsWrite, api.HandleFunc("/posts/{id}/schedule", h.schedulePost).Methods("PUT"))
+	h.scoped(models.ScopePostsWrite, api.HandleFunc("/posts/{id}/publish", h.publishPost).Methods("POST"))
+	h.scoped(models.ScopePostsWrite, api.HandleFunc("/posts/{id}/visibility", h.setPostVisibility).Methods("PUT"))
+	h.scoped(models.ScopePostsWrite, api.HandleFunc("/posts/{id}/pin", h.pinPost).Methods("POST"))
+	h.scoped(models.ScopePostsWrite, api.HandleFunc("/posts/{id}/pin", h.unpinPost).Methods("DELETE"))
+	h.scoped(models.ScopePostsWrite, api.HandleFunc("/posts/{id}/history/{version}/restore", h.restorePostRevision).Methods("POST"))
+
+	// поиск
+	h.scoped(models.ScopePostsRead, api.HandleFunc("/search/posts", h.searchPosts).Methods("GET"))
+	h.scoped(models.ScopeFollowsRead, api.HandleFunc("/search/users", h.searchUsers).Methods("GET"))
+
+	// закладки
+	h.scoped(models.ScopePostsRead, api.HandleFunc("/bookmarks", h.getBookmarks).Methods("GET"))
+	h.scoped(models.ScopePostsRead, api.HandleFunc("/bookmarks/collections", h.getBookmarkCollections).Methods("GET"))
+	h.scoped(models.ScopePostsWrite, api.HandleFunc("/bookmarks/collections", h.createBookmarkCollection).Methods("POST"))
+	h.scoped(models.ScopePostsWrite, api.HandleFunc("/bookmarks/collections/{id}", h.deleteBookmarkCollection).Methods("DELETE"))
 
 	// пользователи
-	api.HandleFunc("/users/{username}/posts", h.getUserPosts).Methods("GET")
-	api.HandleFunc("/users/follow", h.followUser).Methods("POST")
-	api.HandleFunc("/users/unfollow", h.unfollowUser).Methods("POST")
-	api.HandleFunc("/users/followers", h.getFollowers).Methods("GET")
-	api.HandleFunc("/users/following", h.getFollowing).Methods("GET")
-	api.HandleFunc("/users/mutual", h.getMutualFollows).Methods("GET")
+	h.scoped(models.ScopePostsRead, api.HandleFunc("/users/{username}/posts", h.getUserPosts).Methods("GET"))
+	h.scoped(models.ScopePostsRead, api.HandleFunc("/users/{username}/likes", h.getUserLikes).Methods("GET"))
+	h.scoped(models.ScopeFollowsWrite, api.HandleFunc("/users/follow", h.followUser).Methods("POST"))
+	h.scoped(models.ScopeFollowsWrite, api.HandleFunc("/users/unfollow", h.unfollowUser).Methods("POST"))
+	h.scoped(models.ScopeFollowsRead, api.HandleFunc("/users/followers", h.getFollowers).Methods("GET"))
+	h.scoped(models.ScopeFollowsRead, api.HandleFunc("/users/following", h.getFollowing).Methods("GET"))
+	h.scoped(models.ScopeFollowsRead, api.HandleFunc("/users/mutual", h.getMutualFollows).Methods("GET"))
 	api.HandleFunc("/users/{username}", h.deleteAccount).Methods("DELETE")
 	api.HandleFunc("/users/role", h.updateUserRole).Methods("PUT")
+	api.HandleFunc("/users/me/password", h.changePassword).Methods("PUT")
+
+	// двухфакторная аутентификация
+	api.HandleFunc("/2fa/setup", h.setupTwoFactor).Methods("POST")
+	api.HandleFunc("/2fa/enable", h.enableTwoFactor).Methods("POST")
+	api.HandleFunc("/2fa/disable", h.disableTwoFactor).Methods("POST")
+	api.HandleFunc("/2fa/recovery-codes", h.regenerateRecoveryCodes).Methods("POST")
+
+	// права ролей
+	api.HandleFunc("/permissions", h.getPermissions).Methods("GET")
+	api.HandleFunc("/roles/{role}/permissions", h.setRolePermissions).Methods("PUT")
+
+	// блокировки входа
+	api.HandleFunc("/lockouts/{kind}/{key}", h.clearLockout).Methods("DELETE")
+
+	// сессии
+	api.HandleFunc("/sessions", h.getSessions).Methods("GET")
+	api.HandleFunc("/sessions", h.revokeAllSessions).Methods("DELETE")
+	api.HandleFunc("/sessions/{id}", h.revokeSession).Methods("DELETE")
+
+	// персональные токены
+	api.HandleFunc("/tokens", h.createAccessToken).Methods("POST")
+	api.HandleFunc("/tokens", h.getAccessTokens).Methods("GET")
+	api.HandleFunc("/tokens/{id}", h.revokeAccessToken).Methods("DELETE")
+
+	// OAuth-приложения и согласия
+	api.HandleFunc("/oauth/clients", h.createOAuthClient).Methods("POST")
+	api.HandleFunc("/oauth/clients", h.getOAuthClients).Methods("GET")
+	api.HandleFunc("/oauth/clients/{client_id}", h.deleteOAuthClient).Methods("DELETE")
+	api.HandleFunc("/oauth/authorize", h.getAuthorization).Methods("GET")
+	api.HandleFunc("/oauth/authorize", h.authorize).Methods("POST")
+	api.HandleFunc("/oauth/consents", h.getOAuthConsents).Methods("GET")
+	api.HandleFunc("/oauth/consents/{client_id}", h.revokeOAuthConsent).Methods("DELETE")
+}
+
+// scoped открывает маршрут для персональных токенов с указанным правом.
+// Остальные маршруты доступны только при входе по паролю.
+func (h *Handler) scoped(scope string, route *mux.Route) *mux.Route {
+	h.routeScopes[route] = scope
+	return route
 }
 
 func getPaginationParams(r *http.Request) (int, int, bool) {
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"social-network/internal/repository/postgres"
+	"social-network/internal/service"
+)
+
+func (h *Handler) clearLockout(w http.ResponseWriter, r *http.Request) {
+	adminID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	if err := h.services.Lockouts.Clear(adminID, vars["kind"], vars["key"], clientIP(r)); err != nil {
+		switch err {
+		case service.ErrUnknownLockoutKind:
+			http.Error(w, "unknown lockout kind", http.StatusBadRequest)
+		case service.ErrNotAdmin:
+			http.Error(w, "not admin", http.StatusForbidden)
+		case service.ErrTwoFactorRequired:
+			http.Error(w, "two-factor authentication required", http.StatusForbidden)
+		case postgres.ErrLockoutNotFound:
+			http.Error(w, "lockout not found", http.StatusNotFound)
+		default:
+			http.Error(w, "server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
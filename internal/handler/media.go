@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"social-network/internal/repository/postgres"
+	"social-network/internal/service"
+)
+
+// Запас на заголовки multipart поверх самого файла
+const maxUploadBody = service.MaxVideoSize + 1<<20
+
+func (h *Handler) uploadMedia(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBody)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		if _, ok := err.(*http.MaxBytesError); ok {
+			http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "invalid file", http.StatusBadRequest)
+		return
+	}
+
+	media, err := h.services.Media.Upload(userID, data)
+	if err != nil {
+		switch err {
+		case service.ErrPermissionDenied:
+			http.Error(w, "permission denied", http.StatusForbidden)
+		case service.ErrUnsupportedMedia:
+			http.Error(w, "unsupported media type", http.StatusUnsupportedMediaType)
+		case service.ErrMediaTooLarge:
+			http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+		default:
+			http.Error(w, "failed to upload media", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(media)
+}
+
+func (h *Handler) getMedia(w http.ResponseWriter, r *http.Request) {
+	h.serveMedia(w, r, false)
+}
+
+func (h *Handler) getMediaThumbnail(w http.ResponseWriter, r *http.Request) {
+	h.serveMedia(w, r, true)
+}
+
+// serveMedia отдает файл тем, кому виден его пост. Маршрут вне /api, чтобы
+// вложения публичных постов открывались без токена; с токеном доступны и
+// остальные. Общим кэшам разрешено хранить только публичные вложения, и
+// недолго: видимость поста могут сузить, а сам пост удалить.
+func (h *Handler) serveMedia(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	w.Header().Set("Vary", "Authorization")
+
+	viewerID := 0
+	if token := bearerToken(r); token != "" {
+		p, err := h.authenticate(token)
+		if err != nil {
+			http.Error(w, "invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+		if p.Scopes != nil && !h.routeAllows(r, p.Scopes) {
+			http.Error(w, "insufficient token scope", http.StatusForbidden)
+			return
+		}
+		viewerID = p.UserID
+	}
+
+	file, err := h.services.Media.Open(mux.Vars(r)["id"], viewerID, thumbnail)
+	if err != nil {
+		if err == postgres.ErrMediaNotFound {
+			w.Header().Set("Cache-Control", "no-store")
+			http.Error(w, "media not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	defer file.Body.Close()
+
+	w.Header().Set("Content-Type", file.ContentType)
+	if file.Public {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	} else {
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	io.Copy(w, file.Body)
+}
@@ -0,0 +1,372 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"social-network/internal/models"
+	"social-network/internal/repository/postgres"
+	"social-network/internal/service"
+)
+
+type createOAuthClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	// Серверные приложения, способные хранить секрет
+	Confidential bool `json:"confidential"`
+}
+
+type createOAuthClientResponse struct {
+	*models.OAuthClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+type authorizeRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Approved            bool   `json:"approved"`
+}
+
+type authorizationPromptResponse struct {
+	ClientID   string   `json:"client_id"`
+	ClientName string   `json:"client_name"`
+	Scopes     []string `json:"scopes"`
+	Consented  bool     `json:"consented"`
+}
+
+type authorizeResponse struct {
+	RedirectURI string `json:"redirect_uri"`
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+type oauthErrorResponse struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (h *Handler) createOAuthClient(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var req createOAuthClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	client, secret, err := h.services.OAuth.RegisterClient(userID, req.Name, req.RedirectURIs, req.Confidential)
+	if err != nil {
+		switch err {
+		case service.ErrInvalidClientName, service.ErrInvalidRedirectURI:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Секрет показывается один раз
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createOAuthClientResponse{OAuthClient: client, ClientSecret: secret})
+}
+
+func (h *Handler) getOAuthClients(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	clients, err := h.services.OAuth.GetUserClients(userID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clients)
+}
+
+func (h *Handler) deleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.services.OAuth.DeleteClient(userID, mux.Vars(r)["client_id"]); err != nil {
+		if err == postgres.ErrOAuthClientNotFound {
+			http.Error(w, "client not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// getAuthorization проверяет параметры /authorize и отдает фронтенду
+// данные для экрана согласия
+func (h *Handler) getAuthorization(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	prompt, err := h.services.OAuth.PrepareAuthorization(userID, &service.AuthorizationRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	})
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(authorizationPromptResponse{
+		ClientID:   prompt.Client.ClientID,
+		ClientName: prompt.Client.Name,
+		Scopes:     prompt.Scopes,
+		Consented:  prompt.Consented,
+	})
+}
+
+// authorize принимает решение пользователя. Перенаправление делает фронтенд
+// по адресу из ответа.
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var req authorizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI, err := h.services.OAuth.Authorize(userID, &service.AuthorizationRequest{
+		ResponseType:        req.ResponseType,
+		ClientID:            req.ClientID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               req.Scope,
+		State:               req.State,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+	}, req.Approved)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(authorizeResponse{RedirectURI: redirectURI})
+}
+
+// oauthToken - token-эндпоинт RFC 6749, принимает form-urlencoded
+func (h *Handler) oauthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, &service.OAuthError{Code: "invalid_request", Description: "malformed form body"})
+		return
+	}
+
+	creds := clientCredentials(r)
+
+	var (
+		pair *service.OAuthTokenPair
+		err  error
+	)
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		pair, err = h.services.OAuth.ExchangeCode(
+			creds,
+			r.PostForm.Get("code"),
+			r.PostForm.Get("redirect_uri"),
+			r.PostForm.Get("code_verifier"),
+			clientIP(r),
+		)
+	case "refresh_token":
+		pair, err = h.services.OAuth.Refresh(creds, r.PostForm.Get("refresh_token"))
+	default:
+		err = service.ErrOAuthUnsupportedGrantType
+	}
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(oauthTokenResponse{
+		AccessToken:  pair.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    pair.ExpiresIn,
+		RefreshToken: pair.RefreshToken,
+		Scope:        strings.Join(pair.Scopes, " "),
+	})
+}
+
+// oauthIntrospect - RFC 7662
+func (h *Handler) oauthIntrospect(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, &service.OAuthError{Code: "invalid_request", Description: "malformed form body"})
+		return
+	}
+
+	info, err := h.services.OAuth.Introspect(clientCredentials(r), r.PostForm.Get("token"))
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	response := introspectionResponse{Active: info.Active}
+	if info.Active {
+		response.Scope = strings.Join(info.Scopes, " ")
+		response.ClientID = info.ClientID
+		response.Username = info.Username
+		response.Subject = strconv.Itoa(info.UserID)
+		response.TokenType = info.TokenType
+		response.ExpiresAt = info.ExpiresAt.Unix()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// oauthRevoke - RFC 7009, отвечает 200 и для неизвестных токенов
+func (h *Handler) oauthRevoke(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, &service.OAuthError{Code: "invalid_request", Description: "malformed form body"})
+		return
+	}
+
+	if err := h.services.OAuth.Revoke(clientCredentials(r), r.PostForm.Get("token")); err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) getOAuthConsents(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	consents, err := h.services.OAuth.GetUserConsents(userID)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(consents)
+}
+
+// revokeOAuthConsent отзывает доступ приложения вместе с его токенами
+func (h *Handler) revokeOAuthConsent(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.services.OAuth.RevokeConsent(userID, mux.Vars(r)["client_id"]); err != nil {
+		if err == postgres.ErrOAuthConsentNotFound {
+			http.Error(w, "consent not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// clientCredentials берет данные клиента из Basic-авторизации или из формы
+func clientCredentials(r *http.Request) service.ClientCredentials {
+	if id, secret, ok := r.BasicAuth(); ok {
+		// По RFC 6749 значения в Basic предварительно url-кодируются
+		if unescaped, err := url.QueryUnescape(id); err == nil {
+			id = unescaped
+		}
+		if unescaped, err := url.QueryUnescape(secret); err == nil {
+			secret = unescaped
+		}
+		return service.ClientCredentials{ClientID: id, ClientSecret: secret}
+	}
+
+	return service.ClientCredentials{
+		ClientID:     r.PostForm.Get("client_id"),
+		ClientSecret: r.PostForm.Get("client_secret"),
+	}
+}
+
+// writeOAuthError отвечает в формате RFC 6749, а не текстом, как остальные ручки
+func writeOAuthError(w http.ResponseWriter, err error) {
+	oauthErr, ok := err.(*service.OAuthError)
+	if !ok {
+		log.Printf("oauth: %v", err)
+		oauthErr = &service.OAuthError{Code: "server_error"}
+	}
+
+	status := http.StatusBadRequest
+	switch oauthErr.Code {
+	case "invalid_client":
+		status = http.StatusUnauthorized
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	case "server_error":
+		status = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(oauthErrorResponse{
+		Error:       oauthErr.Code,
+		Description: oauthErr.Description,
+	})
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"social-network/internal/models"
+	"social-network/internal/service"
+)
+
+type permissionsResponse struct {
+	Permissions []models.Permission          `json:"permissions"`
+	Roles       map[models.UserRole][]string `json:"roles"`
+}
+
+type setRolePermissionsRequest struct {
+	Permissions []string `json:"permissions"`
+}
+
+func (h *Handler) getPermissions(w http.ResponseWriter, r *http.Request) {
+	adminID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	permissions, roles, err := h.services.Permissions.GetMatrix(adminID)
+	if err != nil {
+		writePermissionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(permissionsResponse{
+		Permissions: permissions,
+		Roles:       roles,
+	})
+}
+
+// setRolePermissions заменяет список прав роли целиком
+func (h *Handler) setRolePermissions(w http.ResponseWriter, r *http.Request) {
+	adminID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req setRolePermissionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	role := mux.Vars(r)["role"]
+	if err := h.services.Permissions.SetRolePermissions(adminID, role, req.Permissions, clientIP(r)); err != nil {
+		writePermissionError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func writePermissionError(w http.ResponseWriter, err error) {
+	switch err {
+	case service.ErrPermissionDenied:
+		http.Error(w, "permission denied", http.StatusForbidden)
+	case service.ErrTwoFactorRequired:
+		http.Error(w, "two-factor authentication required", http.StatusForbidden)
+	case service.ErrUnknownRole:
+		http.Error(w, "unknown role", http.StatusBadRequest)
+	case service.ErrUnknownPermission, service.ErrAdminLockout:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}
+}
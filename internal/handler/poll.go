@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"social-network/internal/repository/postgres"
+	"social-network/internal/service"
+)
+
+// Без множественного выбора options должен содержать один id
+type votePollRequest struct {
+	Options []int `json:"options"`
+}
+
+func (h *Handler) votePoll(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+
+	var req votePollRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	poll, err := h.services.Posts.Vote(postID, userID, req.Options)
+	if err != nil {
+		switch err {
+		case postgres.ErrPostNotFound:
+			http.Error(w, "post not found", http.StatusNotFound)
+		case postgres.ErrPollNotFound:
+			http.Error(w, "poll not found", http.StatusNotFound)
+		case postgres.ErrPollClosed:
+			http.Error(w, "poll is closed", http.StatusConflict)
+		case postgres.ErrAlreadyVoted:
+			http.Error(w, "already voted", http.StatusConflict)
+		case postgres.ErrInvalidPollOption:
+			http.Error(w, "invalid poll options", http.StatusBadRequest)
+		case service.ErrPermissionDenied:
+			http.Error(w, "permission denied", http.StatusForbidden)
+		default:
+			http.Error(w, "server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(poll)
+}
@@ -4,16 +4,41 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 
+	"social-network/internal/models"
 	"social-network/internal/repository/postgres"
 	"social-network/internal/service"
 )
 
+// Draft создает черновик, publish_at - запланированный пост, media - id
+// файлов из POST /api/media, visibility - public (по умолчанию), followers
+// или mentioned. Для ответов и цитат эти поля не учитываются.
 type createPostRequest struct {
-	Content string `json:"content"`
+	Content    string             `json:"content"`
+	Visibility string             `json:"visibility"`
+	Draft      bool               `json:"draft"`
+	PublishAt  *time.Time         `json:"publish_at"`
+	Media      []string           `json:"media"`
+	Poll       *createPollRequest `json:"poll"`
+}
+
+type createPollRequest struct {
+	Options        []string  `json:"options"`
+	ClosesAt       time.Time `json:"closes_at"`
+	MultipleChoice bool      `json:"multiple_choice"`
+}
+
+type schedulePostRequest struct {
+	// null возвращает пост в черновики
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+type setVisibilityRequest struct {
+	Visibility string `json:"visibility"`
 }
 
 type updatePostRequest struct {
@@ -21,11 +46,30 @@ type updatePostRequest struct {
 }
 
 type postResponse struct {
-	ID        int       `json:"id"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
-	Author    string    `json:"author"`
-	Hashtags  []string  `json:"hashtags,omitempty"`
+	ID             int            `json:"id"`
+	Content        string         `json:"content"`
+	CreatedAt      time.Time      `json:"created_at"`
+	Author         string         `json:"author"`
+	Hashtags       []string       `json:"hashtags,omitempty"`
+	Mentions       []string       `json:"mentions,omitempty"`
+	ParentID       *int           `json:"parent_id,omitempty"`
+	QuoteOfID      *int           `json:"quote_of_id,omitempty"`
+	IsQuote        bool           `json:"is_quote"`
+	Edited         bool           `json:"edited"`
+	EditCount      int            `json:"edit_count"`
+	Version        int            `json:"version"`
+	Status         string         `json:"status"`
+	Visibility     string         `json:"visibility"`
+	Pinned         bool           `json:"pinned"`
+	PublishAt      *time.Time     `json:"publish_at,omitempty"`
+	ReplyCount     int            `json:"reply_count"`
+	LikeCount      int            `json:"like_count"`
+	LikedByMe      bool           `json:"liked_by_me"`
+	RepostCount    int            `json:"repost_count"`
+	RepostedByMe   bool           `json:"reposted_by_me"`
+	BookmarkedByMe bool           `json:"bookmarked_by_me"`
+	Media          []models.Media `json:"media,omitempty"`
+	Poll           *models.Poll   `json:"poll,omitempty"`
 }
 
 func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
@@ -41,14 +85,150 @@ func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Пост с вложениями может быть без текста
+	if (len(req.Content) < 1 && len(req.Media) == 0) || len(req.Content) > 280 {
+		http.Error(w, "content must be between 1 and 280 characters", http.StatusBadRequest)
+		return
+	}
+
+	var poll *models.Poll
+	if req.Poll != nil {
+		poll = &models.Poll{ClosesAt: req.Poll.ClosesAt, MultipleChoice: req.Poll.MultipleChoice}
+		for _, text := range req.Poll.Options {
+			poll.Options = append(poll.Options, models.PollOption{Text: text})
+		}
+	}
+
+	var post *models.Post
+	if req.Draft || req.PublishAt != nil {
+		post, err = h.services.Posts.CreateDraft(userID, req.Content, req.Visibility, req.Media, poll, req.PublishAt)
+	} else {
+		post, err = h.services.Posts.Create(userID, req.Content, req.Visibility, req.Media, poll)
+	}
+	if err != nil {
+		switch err {
+		case service.ErrPermissionDenied:
+			http.Error(w, "permission denied", http.StatusForbidden)
+		case service.ErrInvalidPublishTime:
+			http.Error(w, "publish_at must be in the future", http.StatusBadRequest)
+		case service.ErrTooManyAttachments:
+			http.Error(w, "too many attachments", http.StatusBadRequest)
+		case postgres.ErrMediaNotFound:
+			http.Error(w, "media not found", http.StatusBadRequest)
+		case service.ErrInvalidVisibility:
+			http.Error(w, "visibility must be public, followers or mentioned", http.StatusBadRequest)
+		case service.ErrInvalidPoll:
+			http.Error(w, "poll must have 2 to 4 options of up to 100 characters and close in the future", http.StatusBadRequest)
+		default:
+			http.Error(w, "failed to create post", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", postETag(post.Version))
+	json.NewEncoder(w).Encode(postResponse{
+		ID:         post.ID,
+		Content:    post.Content,
+		CreatedAt:  post.CreatedAt,
+		Author:     post.Author.Username,
+		Hashtags:   post.Hashtags,
+		Version:    post.Version,
+		Status:     post.Status,
+		Visibility: post.Visibility,
+		PublishAt:  post.PublishAt,
+		Media:      post.Media,
+		Poll:       post.Poll,
+	})
+}
+
+func (h *Handler) createReply(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	parentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+
+	var req createPostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
 	if len(req.Content) < 1 || len(req.Content) > 280 {
 		http.Error(w, "content must be between 1 and 280 characters", http.StatusBadRequest)
 		return
 	}
 
-	post, err := h.services.Posts.Create(userID, req.Content)
+	post, err := h.services.Posts.CreateReply(parentID, userID, req.Content, req.Visibility)
 	if err != nil {
-		http.Error(w, "failed to create post", http.StatusInternalServerError)
+		switch err {
+		case postgres.ErrPostNotFound:
+			http.Error(w, "post not found", http.StatusNotFound)
+		case service.ErrPermissionDenied:
+			http.Error(w, "permission denied", http.StatusForbidden)
+		case service.ErrInvalidVisibility:
+			http.Error(w, "visibility must be public, followers or mentioned", http.StatusBadRequest)
+		case service.ErrReplyVisibility:
+			http.Error(w, "reply cannot be more visible than its parent", http.StatusBadRequest)
+		default:
+			http.Error(w, "failed to create reply", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(postResponse{
+		ID:         post.ID,
+		Content:    post.Content,
+		CreatedAt:  post.CreatedAt,
+		Author:     post.Author.Username,
+		Hashtags:   post.Hashtags,
+		ParentID:   post.ParentID,
+		Visibility: post.Visibility,
+	})
+}
+
+func (h *Handler) quotePost(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	quotedID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+
+	var req createPostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Content) < 1 || len(req.Content) > 280 {
+		http.Error(w, "content must be between 1 and 280 characters", http.StatusBadRequest)
+		return
+	}
+
+	post, err := h.services.Posts.Quote(quotedID, userID, req.Content)
+	if err != nil {
+		switch err {
+		case postgres.ErrPostNotFound:
+			http.Error(w, "post not found", http.StatusNotFound)
+		case service.ErrPermissionDenied:
+			http.Error(w, "permission denied", http.StatusForbidden)
+		default:
+			http.Error(w, "failed to create quote", http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -59,10 +239,47 @@ func (h *Handler) createPost(w http.ResponseWriter, r *http.Request) {
 		CreatedAt: post.CreatedAt,
 		Author:    post.Author.Username,
 		Hashtags:  post.Hashtags,
+		QuoteOfID: post.QuoteOfID,
+		IsQuote:   post.IsQuote,
 	})
 }
 
+func (h *Handler) getThread(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+
+	page, perPage, _ := getPaginationParams(r)
+
+	thread, err := h.services.Posts.GetThread(postID, viewerID, page, perPage)
+	if err != nil {
+		if err == postgres.ErrPostNotFound {
+			http.Error(w, "post not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(thread)
+}
+
 func (h *Handler) getPost(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
 	vars := mux.Vars(r)
 	postID, err := strconv.Atoi(vars["id"])
 	if err != nil {
@@ -70,7 +287,7 @@ func (h *Handler) getPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	post, err := h.services.Posts.GetByID(postID)
+	post, err := h.services.Posts.GetByID(postID, viewerID)
 	if err != nil {
 		if err == postgres.ErrPostNotFound {
 			http.Error(w, "post not found", http.StatusNotFound)
@@ -81,12 +298,32 @@ func (h *Handler) getPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", postETag(post.Version))
 	json.NewEncoder(w).Encode(postResponse{
-		ID:        post.ID,
-		Content:   post.Content,
-		CreatedAt: post.CreatedAt,
-		Author:    post.Author.Username,
-		Hashtags:  post.Hashtags,
+		ID:             post.ID,
+		Content:        post.Content,
+		CreatedAt:      post.CreatedAt,
+		Author:         post.Author.Username,
+		Hashtags:       post.Hashtags,
+		Mentions:       post.Mentions,
+		ParentID:       post.ParentID,
+		ReplyCount:     post.ReplyCount,
+		QuoteOfID:      post.QuoteOfID,
+		IsQuote:        post.IsQuote,
+		Edited:         post.Edited,
+		EditCount:      post.EditCount,
+		Version:        post.Version,
+		Status:         post.Status,
+		Visibility:     post.Visibility,
+		Pinned:         post.Pinned,
+		PublishAt:      post.PublishAt,
+		LikeCount:      post.LikeCount,
+		LikedByMe:      post.LikedByMe,
+		RepostCount:    post.RepostCount,
+		RepostedByMe:   post.RepostedByMe,
+		BookmarkedByMe: post.BookmarkedByMe,
+		Media:          post.Media,
+		Poll:           post.Poll,
 	})
 }
 
@@ -115,18 +352,68 @@ func (h *Handler) updatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.services.Posts.Update(postID, userID, req.Content); err != nil {
+	expectedVersions, ok := parseIfMatch(r)
+	if !ok {
+		http.Error(w, "post was modified", http.StatusPreconditionFailed)
+		return
+	}
+
+	post, err := h.services.Posts.Update(postID, userID, req.Content, expectedVersions)
+	if err != nil {
 		if err == service.ErrNotYourPost {
 			http.Error(w, "do not have access rights", http.StatusForbidden)
 			return
 		}
+		if err == service.ErrTwoFactorRequired {
+			http.Error(w, "two-factor authentication required", http.StatusForbidden)
+			return
+		}
+		if err == postgres.ErrPostNotFound {
+			http.Error(w, "post not found", http.StatusNotFound)
+			return
+		}
+		if err == postgres.ErrVersionMismatch {
+			http.Error(w, "post was modified", http.StatusPreconditionFailed)
+			return
+		}
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("ETag", postETag(post.Version))
 	w.WriteHeader(http.StatusOK)
 }
 
+// postETag - сильный ETag текста поста, это его версия в кавычках
+func postETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// parseIfMatch возвращает версии из списка If-Match. nil - заголовка нет
+// или он равен "*". Слабые и чужие ETag при строгом сравнении совпасть не
+// могут и пропускаются; ok == false, если не осталось ни одного, и правка
+// должна получить 412.
+func parseIfMatch(r *http.Request) (versions []int, ok bool) {
+	values := r.Header.Values("If-Match")
+	if len(values) == 0 {
+		return nil, true
+	}
+
+	for _, tag := range strings.Split(strings.Join(values, ","), ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return nil, true
+		}
+		if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+			continue
+		}
+		if v, err := strconv.Atoi(tag[1 : len(tag)-1]); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	return versions, len(versions) > 0
+}
+
 func (h *Handler) deletePost(w http.ResponseWriter, r *http.Request) {
 	userID, err := h.getUserIDFromContext(r)
 	if err != nil {
@@ -146,13 +433,248 @@ func (h *Handler) deletePost(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "do not have access rights", http.StatusForbidden)
 			return
 		}
+		if err == service.ErrTwoFactorRequired {
+			http.Error(w, "two-factor authentication required", http.StatusForbidden)
+			return
+		}
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) getPostHistory(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+
+	history, err := h.services.Posts.GetHistory(postID, viewerID)
+	if err != nil {
+		switch err {
+		case postgres.ErrPostNotFound:
+			http.Error(w, "post not found", http.StatusNotFound)
+		case service.ErrPermissionDenied:
+			http.Error(w, "permission denied", http.StatusForbidden)
+		default:
+			http.Error(w, "server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+func (h *Handler) restorePostRevision(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	vars := mux.Vars(r)
+	postID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+
+	version, err := strconv.Atoi(vars["version"])
+	if err != nil {
+		http.Error(w, "invalid version", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.services.Posts.RestoreRevision(postID, version, userID); err != nil {
+		switch err {
+		case postgres.ErrPostNotFound:
+			http.Error(w, "post not found", http.StatusNotFound)
+		case postgres.ErrRevisionNotFound:
+			http.Error(w, "revision not found", http.StatusNotFound)
+		case service.ErrPermissionDenied:
+			http.Error(w, "permission denied", http.StatusForbidden)
+		case service.ErrTwoFactorRequired:
+			http.Error(w, "two-factor authentication required", http.StatusForbidden)
+		default:
+			http.Error(w, "server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) getDrafts(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	page, perPage, _ := getPaginationParams(r)
+
+	posts, err := h.services.Posts.GetDrafts(userID, page, perPage)
+	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(posts)
+}
+
+func (h *Handler) schedulePost(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+
+	var req schedulePostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.services.Posts.Schedule(postID, userID, req.PublishAt); err != nil {
+		writeUnpublishedPostError(w, err)
+		return
+	}
+
 	w.WriteHeader(http.StatusOK)
 }
 
+func (h *Handler) publishPost(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.services.Posts.Publish(postID, userID); err != nil {
+		writeUnpublishedPostError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) setPostVisibility(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+
+	var req setVisibilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.services.Posts.SetVisibility(postID, userID, req.Visibility); err != nil {
+		writeAuthoredPostError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) pinPost(w http.ResponseWriter, r *http.Request) {
+	h.pinAction(w, r, h.services.Posts.Pin)
+}
+
+func (h *Handler) unpinPost(w http.ResponseWriter, r *http.Request) {
+	h.pinAction(w, r, h.services.Posts.Unpin)
+}
+
+func (h *Handler) pinAction(w http.ResponseWriter, r *http.Request, action func(postID, userID int) error) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+
+	if err := action(postID, userID); err != nil {
+		writeAuthoredPostError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeAuthoredPostError - ошибки действий, доступных только автору поста
+func writeAuthoredPostError(w http.ResponseWriter, err error) {
+	switch err {
+	case postgres.ErrPostNotFound:
+		http.Error(w, "post not found", http.StatusNotFound)
+	case service.ErrNotYourPost:
+		http.Error(w, "do not have access rights", http.StatusForbidden)
+	case service.ErrPermissionDenied:
+		http.Error(w, "permission denied", http.StatusForbidden)
+	case service.ErrInvalidVisibility:
+		http.Error(w, "visibility must be public, followers or mentioned", http.StatusBadRequest)
+	case service.ErrPostNotPinnable:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case postgres.ErrTooManyPins:
+		http.Error(w, "at most 3 posts can be pinned", http.StatusConflict)
+	default:
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}
+}
+
+func writeUnpublishedPostError(w http.ResponseWriter, err error) {
+	switch err {
+	case postgres.ErrPostNotFound:
+		http.Error(w, "post not found", http.StatusNotFound)
+	case service.ErrNotYourPost:
+		http.Error(w, "do not have access rights", http.StatusForbidden)
+	case service.ErrPermissionDenied:
+		http.Error(w, "permission denied", http.StatusForbidden)
+	case postgres.ErrPostPublished:
+		http.Error(w, "post is already published", http.StatusConflict)
+	case service.ErrInvalidPublishTime:
+		http.Error(w, "publish_at must be in the future", http.StatusBadRequest)
+	case service.ErrInvalidPoll:
+		http.Error(w, "poll must close after the post is published", http.StatusBadRequest)
+	default:
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}
+}
+
 func (h *Handler) getMyPosts(w http.ResponseWriter, r *http.Request) {
 	userID, err := h.getUserIDFromContext(r)
 	if err != nil {
@@ -172,6 +694,25 @@ func (h *Handler) getMyPosts(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(posts)
 }
 
+func (h *Handler) getMentions(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	page, perPage, desc := getPaginationParams(r)
+
+	posts, err := h.services.Posts.GetMentions(userID, page, perPage, desc)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(posts)
+}
+
 func (h *Handler) getFeed(w http.ResponseWriter, r *http.Request) {
 	userID, err := h.getUserIDFromContext(r)
 	if err != nil {
@@ -193,6 +734,12 @@ func (h *Handler) getFeed(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) getPostsByHashtag(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
 	vars := mux.Vars(r)
 	hashtag := vars["hashtag"]
 	if hashtag == "" {
@@ -202,7 +749,7 @@ func (h *Handler) getPostsByHashtag(w http.ResponseWriter, r *http.Request) {
 
 	page, perPage, desc := getPaginationParams(r)
 
-	posts, err := h.services.Posts.GetPostsByHashtag(hashtag, page, perPage, desc)
+	posts, err := h.services.Posts.GetPostsByHashtag(hashtag, viewerID, page, perPage, desc)
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
@@ -211,3 +758,77 @@ func (h *Handler) getPostsByHashtag(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(posts)
 }
+
+func (h *Handler) likePost(w http.ResponseWriter, r *http.Request) {
+	h.markPost(w, r, h.services.Posts.Like)
+}
+
+func (h *Handler) unlikePost(w http.ResponseWriter, r *http.Request) {
+	h.markPost(w, r, h.services.Posts.Unlike)
+}
+
+func (h *Handler) repostPost(w http.ResponseWriter, r *http.Request) {
+	h.markPost(w, r, h.services.Posts.Repost)
+}
+
+func (h *Handler) unrepostPost(w http.ResponseWriter, r *http.Request) {
+	h.markPost(w, r, h.services.Posts.Unrepost)
+}
+
+// markPost обслуживает лайки и репосты: оба - отметка пользователя на посте
+func (h *Handler) markPost(w http.ResponseWriter, r *http.Request, action func(postID, userID int) error) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+
+	if err := action(postID, userID); err != nil {
+		switch err {
+		case postgres.ErrPostNotFound:
+			http.Error(w, "post not found", http.StatusNotFound)
+		case service.ErrPermissionDenied:
+			http.Error(w, "permission denied", http.StatusForbidden)
+		default:
+			http.Error(w, "server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) getPostLikers(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	postID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid post id", http.StatusBadRequest)
+		return
+	}
+
+	page, perPage, _ := getPaginationParams(r)
+
+	users, err := h.services.Posts.GetLikers(postID, viewerID, page, perPage)
+	if err != nil {
+		if err == postgres.ErrPostNotFound {
+			http.Error(w, "post not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
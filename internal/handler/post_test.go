@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []string
+		want   []int
+		ok     bool
+	}{
+		{"absent", nil, nil, true},
+		{"any", []string{"*"}, nil, true},
+		{"single", []string{`"2"`}, []int{2}, true},
+		{"list", []string{`"2", "3"`}, []int{2, 3}, true},
+		{"repeated header", []string{`"2"`, `"3"`}, []int{2, 3}, true},
+		{"weak and foreign tags skipped", []string{`W/"2", "abc", "4"`}, []int{4}, true},
+		{"nothing usable", []string{`W/"2", 3`}, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("PUT", "/api/posts/1", nil)
+			for _, value := range tt.header {
+				r.Header.Add("If-Match", value)
+			}
+
+			got, ok := parseIfMatch(r)
+			if ok != tt.ok || !slices.Equal(got, tt.want) {
+				t.Errorf("parseIfMatch = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"social-network/internal/service"
+)
+
+// searchPosts - полнотекстовый поиск, синтаксис q см. в service.parseSearchQuery
+func (h *Handler) searchPosts(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	page, perPage, _ := getPaginationParams(r)
+
+	posts, err := h.services.Posts.Search(r.URL.Query().Get("q"), viewerID, page, perPage)
+	if err != nil {
+		if err == service.ErrInvalidSearchQuery {
+			http.Error(w, "invalid search query", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(posts)
+}
+
+// searchUsers - автодополнение и поиск пользователей с опечатками
+func (h *Handler) searchUsers(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	page, perPage, _ := getPaginationParams(r)
+
+	users, err := h.services.Users.Search(r.URL.Query().Get("q"), viewerID, page, perPage)
+	if err != nil {
+		if err == service.ErrInvalidSearchQuery {
+			http.Error(w, "invalid search query", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
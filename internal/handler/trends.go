@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"social-network/internal/service"
+)
+
+func (h *Handler) getTrendingHashtags(w http.ResponseWriter, r *http.Request) {
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = service.DefaultTrendWindow
+	}
+
+	page, perPage, _ := getPaginationParams(r)
+
+	trends, err := h.services.Trends.GetTrending(window, page, perPage)
+	if err != nil {
+		if err == service.ErrUnknownTrendWindow {
+			http.Error(w, "unknown window, expected 1h, 24h or 7d", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trends)
+}
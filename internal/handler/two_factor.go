@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"social-network/internal/service"
+)
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type twoFactorSetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (h *Handler) setupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	setup, err := h.services.TwoFactor.Setup(userID)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(twoFactorSetupResponse{
+		Secret:          setup.Secret,
+		ProvisioningURI: setup.ProvisioningURI,
+	})
+}
+
+func (h *Handler) enableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var req twoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.services.TwoFactor.Enable(userID, req.Code)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (h *Handler) disableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var req twoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.services.TwoFactor.Disable(userID, req.Code); err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var req twoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := h.services.TwoFactor.RegenerateRecoveryCodes(userID, req.Code)
+	if err != nil {
+		writeTwoFactorError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func writeTwoFactorError(w http.ResponseWriter, err error) {
+	switch err {
+	case service.ErrInvalidTOTPCode:
+		http.Error(w, "invalid code", http.StatusBadRequest)
+	case service.ErrTwoFactorEnabled, service.ErrTwoFactorNotEnabled, service.ErrTwoFactorNotSetUp:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}
+}
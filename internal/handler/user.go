@@ -14,12 +14,23 @@ type followRequest struct {
 	Username string `json:"username"`
 }
 
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
 type updateRoleRequest struct {
 	UserID  int    `json:"user_id"`
 	NewRole string `json:"new_role"`
 }
 
 func (h *Handler) getUserPosts(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
 	username := mux.Vars(r)["username"]
 
 	page, perPage, desc := getPaginationParams(r)
@@ -31,7 +42,34 @@ func (h *Handler) getUserPosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	posts, err := h.services.Posts.GetUserPosts(user.ID, page, perPage, desc, hashtag)
+	posts, err := h.services.Posts.GetUserPosts(user.ID, viewerID, page, perPage, desc, hashtag)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(posts)
+}
+
+func (h *Handler) getUserLikes(w http.ResponseWriter, r *http.Request) {
+	viewerID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	username := mux.Vars(r)["username"]
+
+	page, perPage, _ := getPaginationParams(r)
+
+	user, err := h.services.Users.GetUserByUsername(username)
+	if err != nil {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	}
+
+	posts, err := h.services.Posts.GetLikedPosts(user.ID, viewerID, page, perPage)
 	if err != nil {
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
@@ -61,6 +99,10 @@ func (h *Handler) followUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.services.Users.Follow(followerID, userToFollow.ID); err != nil {
+		if err == service.ErrPermissionDenied {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -88,6 +130,10 @@ func (h *Handler) unfollowUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.services.Users.Unfollow(followerID, userToUnfollow.ID); err != nil {
+		if err == service.ErrPermissionDenied {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -170,13 +216,17 @@ func (h *Handler) deleteAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token := r.Header.Get("Authorization")
+	token := bearerToken(r)
 
 	if err := h.services.Users.DeleteAccount(userID, user.ID, withPosts); err != nil {
 		if err == service.ErrNotAdmin {
 			http.Error(w, "do not have access", http.StatusForbidden)
 			return
 		}
+		if err == service.ErrTwoFactorRequired {
+			http.Error(w, "two-factor authentication required", http.StatusForbidden)
+			return
+		}
 		http.Error(w, "failed to delete account", http.StatusInternalServerError)
 		return
 	}
@@ -210,6 +260,8 @@ func (h *Handler) updateUserRole(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "user not found", http.StatusNotFound)
 		case service.ErrNotAdmin:
 			http.Error(w, "not admin", http.StatusForbidden)
+		case service.ErrTwoFactorRequired:
+			http.Error(w, "two-factor authentication required", http.StatusForbidden)
 		case service.ErrUnknownRole:
 			http.Error(w, "unknown role", http.StatusBadRequest)
 		default:
@@ -220,3 +272,33 @@ func (h *Handler) updateUserRole(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 }
+
+func (h *Handler) changePassword(w http.ResponseWriter, r *http.Request) {
+	userID, err := h.getUserIDFromContext(r)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var req changePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.NewPassword) < 6 {
+		http.Error(w, "password too short", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.services.Users.ChangePassword(userID, req.CurrentPassword, req.NewPassword); err != nil {
+		if err == service.ErrWrongPassword {
+			http.Error(w, "wrong current password", http.StatusForbidden)
+			return
+		}
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
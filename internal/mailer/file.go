@@ -0,0 +1,29 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// FileMailer ничего не отправляет, а пишет письма в файл или stdout.
+// Используется для локальной разработки и тестов.
+type FileMailer struct {
+	w    io.Writer
+	from string
+	mu   sync.Mutex
+}
+
+func NewFileMailer(w io.Writer, from string) *FileMailer {
+	return &FileMailer{w: w, from: from}
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := fmt.Fprintf(m.w, "%s\r\n-----\r\n", render(m.from, msg)); err != nil {
+		return fmt.Errorf("write mail: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// render собирает письмо в формате RFC 5322 (text/plain, UTF-8)
+func render(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(msg.Body)
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
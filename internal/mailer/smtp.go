@@ -0,0 +1,32 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+)
+
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPMailer{
+		addr: net.JoinHostPort(host, port),
+		auth: auth,
+		from: from,
+	}
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, render(m.from, msg)); err != nil {
+		return fmt.Errorf("send mail: %w", err)
+	}
+	return nil
+}
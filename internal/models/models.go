@@ -10,24 +10,313 @@ const (
 	RoleAdmin     UserRole = "admin"
 )
 
+var Roles = []UserRole{RoleUser, RoleModerator, RoleAdmin}
+
 // Основные сущности
 type User struct {
 	ID           int       `json:"id"`
 	Username     string    `json:"username"`
+	Email        string    `json:"-"`
 	PasswordHash string    `json:"-"`
 	Role         UserRole  `json:"role"`
+	TOTPSecret   string    `json:"-"`
+	TOTPEnabled  bool      `json:"-"`
+	TOTPLastStep int64     `json:"-"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 type Post struct {
+	ID             int        `json:"id"`
+	AuthorID       int        `json:"author_id"`
+	Author         *User      `json:"author,omitempty"`
+	Content        string     `json:"content"`
+	Hashtags       []string   `json:"hashtags"`
+	Mentions       []string   `json:"mentions"`
+	Media          []Media    `json:"media"`
+	Poll           *Poll      `json:"poll,omitempty"`
+	ParentID       *int       `json:"parent_id,omitempty"`
+	RootID         *int       `json:"root_id,omitempty"`
+	ReplyToUserID  *int       `json:"reply_to_user_id,omitempty"`
+	QuoteOfID      *int       `json:"quote_of_id,omitempty"`
+	IsQuote        bool       `json:"is_quote"`
+	Edited         bool       `json:"edited"`
+	EditCount      int        `json:"edit_count"`
+	Version        int        `json:"version"` // растет с каждой правкой, из нее строится ETag
+	Status         string     `json:"status"`
+	Visibility     string     `json:"visibility"`
+	Pinned         bool       `json:"pinned"`
+	PublishAt      *time.Time `json:"publish_at,omitempty"`
+	LastEditorID   *int       `json:"last_editor_id,omitempty"`
+	ReplyCount     int        `json:"reply_count"`
+	LikeCount      int        `json:"like_count"`
+	LikedByMe      bool       `json:"liked_by_me"`
+	RepostCount    int        `json:"repost_count"`
+	RepostedByMe   bool       `json:"reposted_by_me"`
+	BookmarkedByMe bool       `json:"bookmarked_by_me"`      // закладки приватны, счетчика нет
+	RepostedBy     *string    `json:"reposted_by,omitempty"` // только в ленте, если пост попал в нее через репост
+	RepostedAt     *time.Time `json:"reposted_at,omitempty"`
+	Snippet        string     `json:"snippet,omitempty"` // только в поиске: фрагмент текста с <mark>
+	Replies        []Post     `json:"replies,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// Media - вложение поста. Файл и превью лежат в blob-хранилище,
+// отдаются по URL и ThumbnailURL.
+type Media struct {
+	ID           int       `json:"-"`
+	PublicID     string    `json:"id"`
+	OwnerID      *int      `json:"-"`
+	PostID       *int      `json:"-"`
+	Kind         string    `json:"kind"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	Width        *int      `json:"width,omitempty"`
+	Height       *int      `json:"height,omitempty"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	BlobKey      string    `json:"-"`
+	ThumbnailKey *string   `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+const (
+	MediaKindImage = "image"
+	MediaKindVideo = "video"
+)
+
+// Poll - опрос поста. Пока читатель не проголосовал и опрос не закрыт,
+// результаты скрыты: VoterCount и Votes вариантов пустые.
+type Poll struct {
+	ID             int          `json:"id"`
+	MultipleChoice bool         `json:"multiple_choice"`
+	ClosesAt       time.Time    `json:"closes_at"`
+	Closed         bool         `json:"closed"`
+	Voted          bool         `json:"voted"`
+	VoterCount     *int         `json:"voter_count,omitempty"`
+	Options        []PollOption `json:"options"`
+}
+
+type PollOption struct {
+	ID        int    `json:"id"`
+	Text      string `json:"text"`
+	Votes     *int   `json:"votes,omitempty"`
+	VotedByMe bool   `json:"voted_by_me"`
+}
+
+// Статусы постов. Черновики и запланированные посты видит только автор.
+const (
+	PostStatusDraft     = "draft"
+	PostStatusScheduled = "scheduled"
+	PostStatusPublished = "published"
+)
+
+// BookmarkCollection - именованная подборка закладок пользователя
+type BookmarkCollection struct {
+	ID            int       `json:"id"`
+	UserID        int       `json:"-"`
+	Name          string    `json:"name"`
+	BookmarkCount int       `json:"bookmark_count"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Кому виден пост. Автор видит свои посты всегда.
+const (
+	PostVisibilityPublic    = "public"
+	PostVisibilityFollowers = "followers" // подписчики автора
+	PostVisibilityMentioned = "mentioned" // упомянутые в посте
+)
+
+// PostVisibilities - от самой широкой аудитории к самой узкой
+var PostVisibilities = []string{PostVisibilityPublic, PostVisibilityFollowers, PostVisibilityMentioned}
+
+// Thread - пост, цепочка постов над ним и страница ответов под ним
+type Thread struct {
+	Post      *Post  `json:"post"`
+	Ancestors []Post `json:"ancestors"`
+	Replies   []Post `json:"replies"`
+}
+
+// PostRevision - одна версия текста поста. Changes - отличия от
+// предыдущей версии, у первой версии их нет
+type PostRevision struct {
+	Version   int         `json:"version"`
+	Content   string      `json:"content"`
+	EditorID  *int        `json:"editor_id,omitempty"`
+	Editor    *string     `json:"editor,omitempty"`
+	Current   bool        `json:"current"`
+	Changes   []DiffChunk `json:"changes,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// Операции пословного сравнения
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+type DiffChunk struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+type Session struct {
+	ID         int       `json:"id"`
+	TokenHash  string    `json:"-"`
+	UserID     int       `json:"user_id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type PersonalAccessToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"name"`
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Права персональных токенов и OAuth-приложений
+const (
+	ScopePostsRead    = "posts:read"
+	ScopePostsWrite   = "posts:write"
+	ScopeFollowsRead  = "follows:read"
+	ScopeFollowsWrite = "follows:write"
+)
+
+var Scopes = []string{
+	ScopePostsRead,
+	ScopePostsWrite,
+	ScopeFollowsRead,
+	ScopeFollowsWrite,
+}
+
+// OAuthClient - стороннее приложение. У публичных клиентов нет секрета.
+type OAuthClient struct {
+	ID               int       `json:"-"`
+	ClientID         string    `json:"client_id"`
+	ClientSecretHash string    `json:"-"`
+	Name             string    `json:"name"`
+	OwnerID          int       `json:"-"`
+	RedirectURIs     []string  `json:"redirect_uris"`
+	Confidential     bool      `json:"confidential"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// OAuthConsent - права, которые пользователь уже выдал приложению
+type OAuthConsent struct {
+	UserID     int       `json:"-"`
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type OAuthAuthorizationCode struct {
+	CodeHash      string
+	ClientID      int
+	UserID        int
+	RedirectURI   string
+	Scopes        []string
+	CodeChallenge string
+	ExpiresAt     time.Time
+}
+
+// OAuthToken - пара токенов приложения. Она живет внутри сессии пользователя,
+// поэтому срок действия refresh-токена совпадает со сроком сессии.
+type OAuthToken struct {
+	ID               int
+	SessionID        int
+	ClientID         int
+	UserID           int
+	AccessTokenHash  string
+	RefreshTokenHash string
+	Scopes           []string
+	AccessExpiresAt  time.Time
+	RefreshExpiresAt time.Time
+}
+
+// Виды счетчиков неудачных входов
+const (
+	LockoutKindUsername = "username"
+	LockoutKindIP       = "ip"
+)
+
+// Типы событий безопасности
+const (
+	EventLoginLockout       = "login_lockout"
+	EventLockoutCleared     = "lockout_cleared"
+	EventPermissionsUpdated = "permissions_updated"
+)
+
+// Права ролей. Матрица "роль - право" хранится в БД.
+const (
+	PermPostCreate          = "post.create"
+	PermPostEditOwn         = "post.edit.own"
+	PermPostEditAny         = "post.edit.any"
+	PermPostDeleteOwn       = "post.delete.own"
+	PermPostDeleteAny       = "post.delete.any"
+	PermPostLike            = "post.like"
+	PermPostRepost          = "post.repost"
+	PermPostRevisionRestore = "post.revision.restore"
+	PermPostHistoryRead     = "post.history.read"
+	PermPostPublish         = "post.publish"
+	PermPostVisibility      = "post.visibility"
+	PermPostPin             = "post.pin"
+	PermPollVote            = "poll.vote"
+	PermBookmarkManage      = "bookmark.manage"
+	PermUserFollow          = "user.follow"
+	PermUserDeleteOwn       = "user.delete.own"
+	PermUserDeleteAny       = "user.delete.any"
+	PermUserRoleUpdate      = "user.role.update"
+	PermLockoutClear        = "lockout.clear"
+	PermPermissionManage    = "permission.manage"
+)
+
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Пользоваться правом можно только с включенной 2FA
+	Privileged bool `json:"privileged"`
+}
+
+type SecurityEvent struct {
 	ID        int       `json:"id"`
-	AuthorID  int       `json:"author_id"`
-	Author    *User     `json:"author,omitempty"`
-	Content   string    `json:"content"`
-	Hashtags  []string  `json:"hashtags"`
+	Type      string    `json:"type"`
+	UserID    *int      `json:"user_id,omitempty"`
+	IP        string    `json:"ip"`
+	Details   string    `json:"details"`
 	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// HashtagTrend - хэштег из топа трендов за окно. Baseline - сколько
+// использований за окно было бы нормой, Score - насколько их больше.
+type HashtagTrend struct {
+	Hashtag    string    `json:"hashtag"`
+	Window     string    `json:"window"`
+	Uses       int       `json:"uses"`
+	Baseline   float64   `json:"baseline"`
+	Score      float64   `json:"score"`
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+// PostSearch - разобранный поисковый запрос. Text - слова и фразы в
+// кавычках, остальные поля задаются операторами from:, #, since:, until:.
+type PostSearch struct {
+	Text     string
+	Author   string
+	Hashtags []string
+	Since    *time.Time
+	Until    *time.Time // не включительно
 }
 
 // Типы поиска
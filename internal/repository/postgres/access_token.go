@@ -0,0 +1,135 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"social-network/internal/models"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrAccessTokenNotFound = errors.New("access token not found")
+)
+
+const (
+	createAccessTokenQuery = `
+        INSERT INTO personal_access_tokens (user_id, name, token_hash, scopes, expires_at)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id, created_at`
+
+	// Находим живой токен и заодно отмечаем его использование
+	useAccessTokenQuery = `
+        UPDATE personal_access_tokens
+        SET last_used_at = CURRENT_TIMESTAMP
+        WHERE token_hash = $1
+        AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+        RETURNING id, user_id, name, scopes, created_at, expires_at, last_used_at`
+
+	listAccessTokensQuery = `
+        SELECT id, user_id, name, scopes, created_at, expires_at, last_used_at
+        FROM personal_access_tokens
+        WHERE user_id = $1
+        ORDER BY created_at DESC`
+
+	deleteAccessTokenQuery = `
+        DELETE FROM personal_access_tokens
+        WHERE id = $1 AND user_id = $2`
+)
+
+type AccessTokenRepository struct {
+	db *sql.DB
+}
+
+func NewAccessTokenRepository(db *sql.DB) *AccessTokenRepository {
+	return &AccessTokenRepository{db: db}
+}
+
+func (r *AccessTokenRepository) Create(token *models.PersonalAccessToken) error {
+	err := r.db.QueryRow(
+		createAccessTokenQuery,
+		token.UserID,
+		token.Name,
+		token.TokenHash,
+		pq.Array(token.Scopes),
+		token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("create access token: %w", err)
+	}
+	return nil
+}
+
+func (r *AccessTokenRepository) Use(tokenHash string) (*models.PersonalAccessToken, error) {
+	token, err := scanAccessToken(r.db.QueryRow(useAccessTokenQuery, tokenHash))
+	if err == sql.ErrNoRows {
+		return nil, ErrAccessTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("use access token: %w", err)
+	}
+	return token, nil
+}
+
+func (r *AccessTokenRepository) GetUserTokens(userID int) ([]models.PersonalAccessToken, error) {
+	rows, err := r.db.Query(listAccessTokensQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query access tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []models.PersonalAccessToken
+	for rows.Next() {
+		token, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan access token: %w", err)
+		}
+		tokens = append(tokens, *token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+
+	return tokens, nil
+}
+
+func (r *AccessTokenRepository) Delete(userID, tokenID int) error {
+	result, err := r.db.Exec(deleteAccessTokenQuery, tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("delete access token: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrAccessTokenNotFound
+	}
+
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAccessToken(row rowScanner) (*models.PersonalAccessToken, error) {
+	token := &models.PersonalAccessToken{}
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		pq.Array(&token.Scopes),
+		&token.CreatedAt,
+		&token.ExpiresAt,
+		&token.LastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
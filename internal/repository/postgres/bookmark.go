@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"social-network/internal/models"
+)
+
+var (
+	ErrCollectionNotFound = errors.New("bookmark collection not found")
+	ErrCollectionExists   = errors.New("bookmark collection already exists")
+)
+
+const (
+	// Повторная закладка переносит пост в другую подборку. Подборка
+	// должна принадлежать тому же пользователю.
+	addBookmarkQuery = `
+        INSERT INTO bookmarks (user_id, post_id, collection_id)
+        SELECT $1, $2, $3
+        WHERE $3::integer IS NULL OR EXISTS (
+            SELECT 1 FROM bookmark_collections WHERE id = $3 AND user_id = $1
+        )
+        ON CONFLICT (user_id, post_id) DO UPDATE SET collection_id = EXCLUDED.collection_id`
+
+	removeBookmarkQuery = `
+        DELETE FROM bookmarks
+        WHERE user_id = $1 AND post_id = $2`
+
+	createCollectionQuery = `
+        INSERT INTO bookmark_collections (user_id, name)
+        VALUES ($1, $2)
+        RETURNING id, created_at`
+
+	listCollectionsQuery = `
+        SELECT c.id, c.user_id, c.name, COUNT(b.post_id), c.created_at
+        FROM bookmark_collections c
+        LEFT JOIN bookmarks b ON b.collection_id = c.id
+        WHERE c.user_id = $1
+        GROUP BY c.id
+        ORDER BY c.name`
+
+	deleteCollectionQuery = `
+        DELETE FROM bookmark_collections
+        WHERE id = $1 AND user_id = $2`
+)
+
+type BookmarkRepository struct {
+	db *sql.DB
+}
+
+func NewBookmarkRepository(db *sql.DB) *BookmarkRepository {
+	return &BookmarkRepository{db: db}
+}
+
+// Add добавляет пост в закладки, collectionID == nil - без подборки
+func (r *BookmarkRepository) Add(userID, postID int, collectionID *int) error {
+	result, err := r.db.Exec(addBookmarkQuery, userID, postID, collectionID)
+	if err != nil {
+		if isPgForeignKeyError(err) {
+			return ErrPostNotFound
+		}
+		return fmt.Errorf("add bookmark: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrCollectionNotFound
+	}
+
+	return nil
+}
+
+// Remove идемпотентен, как и Unlike
+func (r *BookmarkRepository) Remove(userID, postID int) error {
+	if _, err := r.db.Exec(removeBookmarkQuery, userID, postID); err != nil {
+		return fmt.Errorf("remove bookmark: %w", err)
+	}
+	return nil
+}
+
+func (r *BookmarkRepository) CreateCollection(collection *models.BookmarkCollection) error {
+	err := r.db.QueryRow(createCollectionQuery, collection.UserID, collection.Name).Scan(&collection.ID, &collection.CreatedAt)
+	if err != nil {
+		if isPgDuplicateError(err) {
+			return ErrCollectionExists
+		}
+		return fmt.Errorf("create bookmark collection: %w", err)
+	}
+	return nil
+}
+
+func (r *BookmarkRepository) GetCollections(userID int) ([]models.BookmarkCollection, error) {
+	rows, err := r.db.Query(listCollectionsQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query bookmark collections: %w", err)
+	}
+	defer rows.Close()
+
+	collections := []models.BookmarkCollection{}
+	for rows.Next() {
+		var c models.BookmarkCollection
+		if err := rows.Scan(&c.ID, &c.UserID, &c.Name, &c.BookmarkCount, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan bookmark collection: %w", err)
+		}
+		collections = append(collections, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+
+	return collections, nil
+}
+
+// DeleteCollection удаляет подборку, закладки из нее остаются без подборки
+func (r *BookmarkRepository) DeleteCollection(userID, collectionID int) error {
+	result, err := r.db.Exec(deleteCollectionQuery, collectionID, userID)
+	if err != nil {
+		return fmt.Errorf("delete bookmark collection: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrCollectionNotFound
+	}
+
+	return nil
+}
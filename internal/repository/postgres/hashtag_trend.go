@@ -0,0 +1,126 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"social-network/internal/models"
+	"time"
+)
+
+const (
+	clearTrendsQuery = `DELETE FROM hashtag_trends WHERE window_name = $1`
+
+	// Использования в окне ($2, $1] взвешиваются по свежести: вес
+	// использования вдвое меньше каждые $4 секунд. Норма - среднее число
+	// использований за окно в предыдущем периоде ($3, $2], $6 - сколько
+	// окон в этом периоде. Счет - превышение нормы, деленное на ее корень,
+	// чтобы редкий хэштег с парой новых постов не обгонял популярные.
+	// Учитываются только публичные посты: тренды видны всем.
+	refreshTrendsQuery = `
+        WITH uses AS (
+            SELECT ph.hashtag_id,
+                   COUNT(*) FILTER (WHERE p.created_at > $2) AS uses,
+                   COALESCE(SUM(power(0.5, EXTRACT(EPOCH FROM $1::timestamptz - p.created_at) / $4))
+                       FILTER (WHERE p.created_at > $2), 0) AS decayed,
+                   COUNT(*) FILTER (WHERE p.created_at <= $2)::double precision / $6 AS baseline
+            FROM post_hashtags ph
+            JOIN posts p ON p.id = ph.post_id
+            WHERE p.created_at > $3 AND p.created_at <= $1
+            AND p.status = 'published' AND p.visibility = 'public'
+            GROUP BY ph.hashtag_id
+        ), scored AS (
+            SELECT hashtag_id, uses, baseline,
+                   (decayed - baseline) / sqrt(baseline + 1) AS score
+            FROM uses
+            WHERE uses >= $7
+        )
+        INSERT INTO hashtag_trends (window_name, hashtag_id, uses, baseline, score, computed_at)
+        SELECT $5, hashtag_id, uses, baseline, score, $1
+        FROM scored
+        WHERE score > 0
+        ORDER BY score DESC
+        LIMIT $8`
+
+	getTrendsQuery = `
+        SELECT h.name, t.uses, t.baseline, t.score, t.computed_at
+        FROM hashtag_trends t
+        JOIN hashtags h ON h.id = t.hashtag_id
+        WHERE t.window_name = $1
+        ORDER BY t.score DESC, h.name
+        LIMIT $2 OFFSET $3`
+)
+
+// TrendWindow - окно трендов и период, по которому считается норма
+type TrendWindow struct {
+	Name     string
+	Length   time.Duration
+	Baseline time.Duration
+}
+
+type HashtagTrendRepository struct {
+	db *sql.DB
+}
+
+func NewHashtagTrendRepository(db *sql.DB) *HashtagTrendRepository {
+	return &HashtagTrendRepository{db: db}
+}
+
+// Refresh пересчитывает тренды окна на момент now и заменяет прежние.
+// Замена идет в транзакции, так что читатели видят либо старые тренды,
+// либо новые. minUses отсекает случайные всплески, limit - размер топа.
+func (r *HashtagTrendRepository) Refresh(window TrendWindow, now time.Time, minUses, limit int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(clearTrendsQuery, window.Name); err != nil {
+		return fmt.Errorf("clear trends: %w", err)
+	}
+
+	_, err = tx.Exec(
+		refreshTrendsQuery,
+		now,
+		now.Add(-window.Length),
+		now.Add(-window.Length-window.Baseline),
+		(window.Length / 2).Seconds(),
+		window.Name,
+		float64(window.Baseline)/float64(window.Length),
+		minUses,
+		limit,
+	)
+	if err != nil {
+		return fmt.Errorf("refresh trends: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (r *HashtagTrendRepository) GetTrending(window string, page, perPage int) ([]models.HashtagTrend, error) {
+	if err := validatePagination(page, perPage); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(getTrendsQuery, window, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, fmt.Errorf("query trends: %w", err)
+	}
+	defer rows.Close()
+
+	trends := []models.HashtagTrend{}
+	for rows.Next() {
+		var trend models.HashtagTrend
+		if err := rows.Scan(&trend.Hashtag, &trend.Uses, &trend.Baseline, &trend.Score, &trend.ComputedAt); err != nil {
+			return nil, fmt.Errorf("scan trend: %w", err)
+		}
+		trend.Window = window
+		trends = append(trends, trend)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+
+	return trends, nil
+}
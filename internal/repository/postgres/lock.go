@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// LockRepository выдает advisory-блокировки Postgres для фоновых задач
+type LockRepository struct {
+	db *sql.DB
+}
+
+func NewLockRepository(db *sql.DB) *LockRepository {
+	return &LockRepository{db: db}
+}
+
+// Leader возвращает блокировку для выбора лидера среди экземпляров сервиса
+func (r *LockRepository) Leader(key int64) *LeaderLock {
+	return &LeaderLock{db: r.db, key: key}
+}
+
+// LeaderLock - сессионная advisory-блокировка на выделенном соединении.
+// Пока соединение живо, лидер - этот экземпляр. Если процесс упал или
+// соединение оборвалось, Postgres снимет блокировку сам и лидером станет
+// другой экземпляр.
+type LeaderLock struct {
+	db  *sql.DB
+	key int64
+
+	mu   sync.Mutex
+	conn *sql.Conn
+}
+
+// Acquire проверяет, что блокировка все еще наша, или пробует ее взять.
+// Не ждет: если блокировка занята, сразу возвращает false.
+func (l *LeaderLock) Acquire() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ctx := context.Background()
+	if l.conn != nil {
+		if err := l.conn.PingContext(ctx); err == nil {
+			return true, nil
+		}
+		// Соединение потеряно вместе с блокировкой
+		l.conn.Close()
+		l.conn = nil
+	}
+
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return false, fmt.Errorf("get connection: %w", err)
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&acquired); err != nil {
+		conn.Close()
+		return false, fmt.Errorf("try advisory lock: %w", err)
+	}
+	if !acquired {
+		conn.Close()
+		return false, nil
+	}
+
+	l.conn = conn
+	return true, nil
+}
+
+// Release отдает лидерство, если оно было
+func (l *LeaderLock) Release() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return nil
+	}
+	defer func() {
+		l.conn.Close()
+		l.conn = nil
+	}()
+
+	if _, err := l.conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", l.key); err != nil {
+		return fmt.Errorf("advisory unlock: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrLockoutNotFound = errors.New("lockout not found")
+)
+
+const (
+	getLockedUntilQuery = `
+        SELECT MAX(locked_until)
+        FROM login_attempts
+        WHERE ((kind = 'username' AND key = $1) OR (kind = 'ip' AND key = $2))
+        AND locked_until > CURRENT_TIMESTAMP`
+
+	// Счетчик начинается заново, если неудач давно не было
+	registerFailureQuery = `
+        INSERT INTO login_attempts (kind, key, failures, last_failure_at)
+        VALUES ($1, $2, 1, CURRENT_TIMESTAMP)
+        ON CONFLICT (kind, key) DO UPDATE SET
+            failures = CASE
+                WHEN login_attempts.last_failure_at < $3 THEN 1
+                ELSE login_attempts.failures + 1
+            END,
+            last_failure_at = CURRENT_TIMESTAMP
+        RETURNING failures`
+
+	lockQuery = `
+        UPDATE login_attempts SET locked_until = $3
+        WHERE kind = $1 AND key = $2`
+
+	resetAttemptsQuery = `DELETE FROM login_attempts WHERE kind = $1 AND key = $2`
+)
+
+type LockoutRepository struct {
+	db *sql.DB
+}
+
+func NewLockoutRepository(db *sql.DB) *LockoutRepository {
+	return &LockoutRepository{db: db}
+}
+
+// GetLockedUntil возвращает самую позднюю активную блокировку по имени или IP
+func (r *LockoutRepository) GetLockedUntil(username, ip string) (time.Time, bool, error) {
+	var lockedUntil sql.NullTime
+	if err := r.db.QueryRow(getLockedUntilQuery, username, ip).Scan(&lockedUntil); err != nil {
+		return time.Time{}, false, fmt.Errorf("query lockout: %w", err)
+	}
+	return lockedUntil.Time, lockedUntil.Valid, nil
+}
+
+// RegisterFailure увеличивает счетчик неудач и возвращает его новое значение.
+// Неудачи раньше since не учитываются.
+func (r *LockoutRepository) RegisterFailure(kind, key string, since time.Time) (int, error) {
+	var failures int
+	if err := r.db.QueryRow(registerFailureQuery, kind, key, since).Scan(&failures); err != nil {
+		return 0, fmt.Errorf("register login failure: %w", err)
+	}
+	return failures, nil
+}
+
+func (r *LockoutRepository) Lock(kind, key string, until time.Time) error {
+	if _, err := r.db.Exec(lockQuery, kind, key, until); err != nil {
+		return fmt.Errorf("lock login: %w", err)
+	}
+	return nil
+}
+
+func (r *LockoutRepository) Reset(kind, key string) error {
+	result, err := r.db.Exec(resetAttemptsQuery, kind, key)
+	if err != nil {
+		return fmt.Errorf("reset login attempts: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrLockoutNotFound
+	}
+
+	return nil
+}
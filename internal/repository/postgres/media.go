@@ -0,0 +1,204 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"social-network/internal/models"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrMediaNotFound = errors.New("media not found")
+
+// Файлы отдает сам сервис, см. handler.getMedia
+const mediaURLPrefix = "/media/"
+
+const (
+	mediaColumns = `
+        id, public_id, owner_id, post_id, kind, content_type, size, width, height,
+        blob_key, thumbnail_key, created_at`
+
+	createMediaQuery = `
+        INSERT INTO media (public_id, owner_id, kind, content_type, size, width, height, blob_key, thumbnail_key)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        RETURNING id, created_at`
+
+	getMediaQuery = `SELECT` + mediaColumns + `
+        FROM media
+        WHERE public_id = $1`
+
+	// Прикрепить можно только свои еще не прикрепленные файлы. Колонки
+	// unnest названы иначе, чем в media: RETURNING видит обе таблицы.
+	attachMediaQuery = `
+        UPDATE media m
+        SET post_id = $1, position = a.ord
+        FROM unnest($3::text[]) WITH ORDINALITY AS a(media_id, ord)
+        WHERE m.public_id = a.media_id AND m.owner_id = $2 AND m.post_id IS NULL
+        RETURNING m.position,` + mediaColumns
+
+	// Строки забираются DELETE ... RETURNING, поэтому несколько экземпляров
+	// сервиса могут чистить одновременно, не мешая друг другу
+	deleteOrphanMediaQuery = `
+        DELETE FROM media
+        WHERE id IN (
+            SELECT id FROM media
+            WHERE post_id IS NULL AND created_at < $1
+            ORDER BY created_at
+            LIMIT $2
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING` + mediaColumns
+
+	// Вложения поста для basePostColumns, в формате models.Media
+	postMediaColumn = `
+               COALESCE((
+                   SELECT json_agg(json_build_object(
+                       'id', md.public_id,
+                       'kind', md.kind,
+                       'content_type', md.content_type,
+                       'size', md.size,
+                       'width', md.width,
+                       'height', md.height,
+                       'url', '` + mediaURLPrefix + `' || md.public_id,
+                       'thumbnail_url', CASE WHEN md.thumbnail_key IS NOT NULL
+                           THEN '` + mediaURLPrefix + `' || md.public_id || '/thumbnail' END,
+                       'created_at', md.created_at
+                   ) ORDER BY md.position)
+                   FROM media md WHERE md.post_id = p.id
+               ), '[]') AS media`
+)
+
+type MediaRepository struct {
+	db *sql.DB
+}
+
+func NewMediaRepository(db *sql.DB) *MediaRepository {
+	return &MediaRepository{db: db}
+}
+
+func (r *MediaRepository) Create(media *models.Media) error {
+	err := r.db.QueryRow(
+		createMediaQuery,
+		media.PublicID,
+		media.OwnerID,
+		media.Kind,
+		media.ContentType,
+		media.Size,
+		media.Width,
+		media.Height,
+		media.BlobKey,
+		media.ThumbnailKey,
+	).Scan(&media.ID, &media.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("create media: %w", err)
+	}
+
+	setMediaURLs(media)
+	return nil
+}
+
+func (r *MediaRepository) GetByPublicID(publicID string) (*models.Media, error) {
+	media, err := scanMedia(r.db.QueryRow(getMediaQuery, publicID))
+	if err == sql.ErrNoRows {
+		return nil, ErrMediaNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query media: %w", err)
+	}
+
+	return media, nil
+}
+
+// DeleteOrphans удаляет до limit файлов без поста, загруженных раньше
+// olderThan, и возвращает их, чтобы вызывающий удалил blob-ы
+func (r *MediaRepository) DeleteOrphans(olderThan time.Time, limit int) ([]models.Media, error) {
+	rows, err := r.db.Query(deleteOrphanMediaQuery, olderThan, limit)
+	if err != nil {
+		return nil, fmt.Errorf("delete orphan media: %w", err)
+	}
+	defer rows.Close()
+
+	var deleted []models.Media
+	for rows.Next() {
+		media, err := scanMedia(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan media: %w", err)
+		}
+		deleted = append(deleted, *media)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// attachMedia прикрепляет к посту файлы автора в порядке publicIDs
+func attachMedia(tx *sql.Tx, postID, ownerID int, publicIDs []string) ([]models.Media, error) {
+	rows, err := tx.Query(attachMediaQuery, postID, ownerID, pq.Array(publicIDs))
+	if err != nil {
+		return nil, fmt.Errorf("attach media: %w", err)
+	}
+	defer rows.Close()
+
+	positions := make(map[string]int, len(publicIDs))
+	var attached []models.Media
+	for rows.Next() {
+		var position int
+		media, err := scanMedia(rows, &position)
+		if err != nil {
+			return nil, fmt.Errorf("scan media: %w", err)
+		}
+		positions[media.PublicID] = position
+		attached = append(attached, *media)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+
+	if len(attached) != len(publicIDs) {
+		return nil, ErrMediaNotFound
+	}
+
+	sort.Slice(attached, func(i, j int) bool {
+		return positions[attached[i].PublicID] < positions[attached[j].PublicID]
+	})
+	return attached, nil
+}
+
+// scanMedia читает mediaColumns; prefix - колонки перед ними
+func scanMedia(row rowScanner, prefix ...interface{}) (*models.Media, error) {
+	var media models.Media
+	dest := append(prefix,
+		&media.ID,
+		&media.PublicID,
+		&media.OwnerID,
+		&media.PostID,
+		&media.Kind,
+		&media.ContentType,
+		&media.Size,
+		&media.Width,
+		&media.Height,
+		&media.BlobKey,
+		&media.ThumbnailKey,
+		&media.CreatedAt,
+	)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	setMediaURLs(&media)
+	return &media, nil
+}
+
+func setMediaURLs(media *models.Media) {
+	media.URL = mediaURLPrefix + media.PublicID
+	if media.ThumbnailKey != nil {
+		media.ThumbnailURL = mediaURLPrefix + media.PublicID + "/thumbnail"
+	}
+}
@@ -0,0 +1,493 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"social-network/internal/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrOAuthClientNotFound       = errors.New("oauth client not found")
+	ErrOAuthConsentNotFound      = errors.New("oauth consent not found")
+	ErrAuthorizationCodeNotFound = errors.New("authorization code not found")
+	ErrOAuthTokenNotFound        = errors.New("oauth token not found")
+)
+
+const (
+	createOAuthClientQuery = `
+        INSERT INTO oauth_clients (client_id, client_secret_hash, name, owner_id, redirect_uris)
+        VALUES ($1, NULLIF($2, ''), $3, $4, $5)
+        RETURNING id, created_at`
+
+	baseOAuthClientSelect = `
+        SELECT id, client_id, COALESCE(client_secret_hash, ''), name, owner_id, redirect_uris, created_at
+        FROM oauth_clients`
+
+	getOAuthClientQuery = baseOAuthClientSelect + `
+        WHERE client_id = $1`
+
+	listOAuthClientsQuery = baseOAuthClientSelect + `
+        WHERE owner_id = $1
+        ORDER BY created_at DESC`
+
+	deleteOAuthClientQuery = `
+        DELETE FROM oauth_clients
+        WHERE client_id = $1 AND owner_id = $2`
+
+	// Сессии приложения удаляем отдельно, каскад от клиента удалил бы только токены
+	deleteClientSessionsQuery = `
+        DELETE FROM sessions
+        WHERE id IN (
+            SELECT t.session_id
+            FROM oauth_tokens t
+            JOIN oauth_clients c ON c.id = t.client_id
+            WHERE c.client_id = $1 AND c.owner_id = $2
+        )`
+
+	getOAuthConsentQuery = `
+        SELECT scopes FROM oauth_consents
+        WHERE user_id = $1 AND client_id = $2`
+
+	// Новые права добавляются к уже выданным
+	saveOAuthConsentQuery = `
+        INSERT INTO oauth_consents (user_id, client_id, scopes)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (user_id, client_id) DO UPDATE
+        SET scopes = ARRAY(
+                SELECT DISTINCT unnest(oauth_consents.scopes || EXCLUDED.scopes)
+            ),
+            updated_at = CURRENT_TIMESTAMP`
+
+	listOAuthConsentsQuery = `
+        SELECT c.client_id, c.name, oc.scopes, oc.created_at, oc.updated_at
+        FROM oauth_consents oc
+        JOIN oauth_clients c ON c.id = oc.client_id
+        WHERE oc.user_id = $1
+        ORDER BY oc.updated_at DESC`
+
+	deleteOAuthConsentQuery = `
+        DELETE FROM oauth_consents oc
+        USING oauth_clients c
+        WHERE oc.client_id = c.id AND oc.user_id = $1 AND c.client_id = $2`
+
+	deleteConsentSessionsQuery = `
+        DELETE FROM sessions
+        WHERE id IN (
+            SELECT t.session_id
+            FROM oauth_tokens t
+            JOIN oauth_clients c ON c.id = t.client_id
+            WHERE t.user_id = $1 AND c.client_id = $2
+        )`
+
+	deleteExpiredCodesQuery = `
+        DELETE FROM oauth_authorization_codes WHERE expires_at <= CURRENT_TIMESTAMP`
+
+	createAuthorizationCodeQuery = `
+        INSERT INTO oauth_authorization_codes
+            (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	// Код одноразовый: удаляем его при первом же обмене
+	useAuthorizationCodeQuery = `
+        DELETE FROM oauth_authorization_codes
+        WHERE code_hash = $1
+        RETURNING client_id, user_id, redirect_uri, scopes, code_challenge, expires_at`
+
+	createOAuthTokenQuery = `
+        INSERT INTO oauth_tokens
+            (session_id, client_id, user_id, access_token_hash, refresh_token_hash, scopes, access_expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING id`
+
+	// Старый refresh-токен перестает действовать сразу после обмена
+	rotateOAuthTokenQuery = `
+        UPDATE oauth_tokens t
+        SET access_token_hash = $3, refresh_token_hash = $4, access_expires_at = $5
+        FROM sessions s
+        WHERE t.refresh_token_hash = $1 AND t.client_id = $2
+        AND s.id = t.session_id AND s.expires_at > CURRENT_TIMESTAMP
+        RETURNING t.id, t.session_id, t.user_id, t.scopes`
+
+	extendOAuthSessionQuery = `
+        UPDATE sessions
+        SET last_seen_at = CURRENT_TIMESTAMP, expires_at = $2
+        WHERE id = $1`
+
+	// Находим живой access-токен и отмечаем активность сессии
+	useOAuthTokenQuery = `
+        UPDATE sessions s
+        SET last_seen_at = CURRENT_TIMESTAMP
+        FROM oauth_tokens t
+        WHERE t.access_token_hash = $1 AND s.id = t.session_id
+        AND t.access_expires_at > CURRENT_TIMESTAMP AND s.expires_at > CURRENT_TIMESTAMP
+        RETURNING t.id, t.session_id, t.client_id, t.user_id, t.scopes, t.access_expires_at, s.expires_at`
+
+	// Ищет токен любого типа, нужен для интроспекции
+	findOAuthTokenQuery = `
+        SELECT t.id, t.session_id, t.client_id, t.user_id, t.access_token_hash, t.refresh_token_hash,
+               t.scopes, t.access_expires_at, s.expires_at
+        FROM oauth_tokens t
+        JOIN sessions s ON s.id = t.session_id
+        WHERE (t.access_token_hash = $1 OR t.refresh_token_hash = $1)
+        AND s.expires_at > CURRENT_TIMESTAMP`
+
+	// Отзыв любого из токенов отзывает всю выдачу вместе с сессией
+	revokeOAuthTokenQuery = `
+        DELETE FROM sessions
+        WHERE id IN (
+            SELECT session_id FROM oauth_tokens
+            WHERE client_id = $1 AND (access_token_hash = $2 OR refresh_token_hash = $2)
+        )`
+)
+
+type OAuthRepository struct {
+	db *sql.DB
+}
+
+func NewOAuthRepository(db *sql.DB) *OAuthRepository {
+	return &OAuthRepository{db: db}
+}
+
+func (r *OAuthRepository) CreateClient(client *models.OAuthClient) error {
+	err := r.db.QueryRow(
+		createOAuthClientQuery,
+		client.ClientID,
+		client.ClientSecretHash,
+		client.Name,
+		client.OwnerID,
+		pq.Array(client.RedirectURIs),
+	).Scan(&client.ID, &client.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("create oauth client: %w", err)
+	}
+	client.Confidential = client.ClientSecretHash != ""
+	return nil
+}
+
+func (r *OAuthRepository) GetClient(clientID string) (*models.OAuthClient, error) {
+	client, err := scanOAuthClient(r.db.QueryRow(getOAuthClientQuery, clientID))
+	if err == sql.ErrNoRows {
+		return nil, ErrOAuthClientNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get oauth client: %w", err)
+	}
+	return client, nil
+}
+
+func (r *OAuthRepository) GetUserClients(ownerID int) ([]models.OAuthClient, error) {
+	rows, err := r.db.Query(listOAuthClientsQuery, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("query oauth clients: %w", err)
+	}
+	defer rows.Close()
+
+	var clients []models.OAuthClient
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan oauth client: %w", err)
+		}
+		clients = append(clients, *client)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+
+	return clients, nil
+}
+
+// DeleteClient удаляет приложение вместе с сессиями, которые ему выданы
+func (r *OAuthRepository) DeleteClient(ownerID int, clientID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(deleteClientSessionsQuery, clientID, ownerID); err != nil {
+		return fmt.Errorf("delete client sessions: %w", err)
+	}
+
+	result, err := tx.Exec(deleteOAuthClientQuery, clientID, ownerID)
+	if err != nil {
+		return fmt.Errorf("delete oauth client: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrOAuthClientNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (r *OAuthRepository) GetConsentScopes(userID, clientID int) ([]string, error) {
+	var scopes []string
+	err := r.db.QueryRow(getOAuthConsentQuery, userID, clientID).Scan(pq.Array(&scopes))
+	if err == sql.ErrNoRows {
+		return nil, ErrOAuthConsentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get oauth consent: %w", err)
+	}
+	return scopes, nil
+}
+
+func (r *OAuthRepository) SaveConsent(userID, clientID int, scopes []string) error {
+	if _, err := r.db.Exec(saveOAuthConsentQuery, userID, clientID, pq.Array(scopes)); err != nil {
+		return fmt.Errorf("save oauth consent: %w", err)
+	}
+	return nil
+}
+
+func (r *OAuthRepository) GetUserConsents(userID int) ([]models.OAuthConsent, error) {
+	rows, err := r.db.Query(listOAuthConsentsQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query oauth consents: %w", err)
+	}
+	defer rows.Close()
+
+	var consents []models.OAuthConsent
+	for rows.Next() {
+		consent := models.OAuthConsent{UserID: userID}
+		err := rows.Scan(
+			&consent.ClientID,
+			&consent.ClientName,
+			pq.Array(&consent.Scopes),
+			&consent.CreatedAt,
+			&consent.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan oauth consent: %w", err)
+		}
+		consents = append(consents, consent)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+
+	return consents, nil
+}
+
+// DeleteConsent отзывает согласие и все токены, выданные по нему
+func (r *OAuthRepository) DeleteConsent(userID int, clientID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(deleteConsentSessionsQuery, userID, clientID); err != nil {
+		return fmt.Errorf("delete consent sessions: %w", err)
+	}
+
+	result, err := tx.Exec(deleteOAuthConsentQuery, userID, clientID)
+	if err != nil {
+		return fmt.Errorf("delete oauth consent: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrOAuthConsentNotFound
+	}
+
+	return tx.Commit()
+}
+
+// CreateCode сохраняет код и заодно чистит просроченные
+func (r *OAuthRepository) CreateCode(code *models.OAuthAuthorizationCode) error {
+	if _, err := r.db.Exec(deleteExpiredCodesQuery); err != nil {
+		return fmt.Errorf("delete expired codes: %w", err)
+	}
+
+	_, err := r.db.Exec(
+		createAuthorizationCodeQuery,
+		code.CodeHash,
+		code.ClientID,
+		code.UserID,
+		code.RedirectURI,
+		pq.Array(code.Scopes),
+		code.CodeChallenge,
+		code.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("create authorization code: %w", err)
+	}
+	return nil
+}
+
+func (r *OAuthRepository) UseCode(codeHash string) (*models.OAuthAuthorizationCode, error) {
+	code := &models.OAuthAuthorizationCode{CodeHash: codeHash}
+	err := r.db.QueryRow(useAuthorizationCodeQuery, codeHash).Scan(
+		&code.ClientID,
+		&code.UserID,
+		&code.RedirectURI,
+		pq.Array(&code.Scopes),
+		&code.CodeChallenge,
+		&code.ExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrAuthorizationCodeNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("use authorization code: %w", err)
+	}
+
+	if time.Now().After(code.ExpiresAt) {
+		return nil, ErrAuthorizationCodeNotFound
+	}
+
+	return code, nil
+}
+
+// CreateToken открывает для приложения новую сессию и кладет в нее пару токенов
+func (r *OAuthRepository) CreateToken(session *models.Session, token *models.OAuthToken) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
+		createSessionQuery,
+		"",
+		session.UserID,
+		session.UserAgent,
+		session.IP,
+		session.ExpiresAt,
+	).Scan(&session.ID, &session.CreatedAt, &session.LastSeenAt)
+	if err != nil {
+		return fmt.Errorf("create session: %w", err)
+	}
+
+	token.SessionID = session.ID
+	token.RefreshExpiresAt = session.ExpiresAt
+	err = tx.QueryRow(
+		createOAuthTokenQuery,
+		token.SessionID,
+		token.ClientID,
+		token.UserID,
+		token.AccessTokenHash,
+		token.RefreshTokenHash,
+		pq.Array(token.Scopes),
+		token.AccessExpiresAt,
+	).Scan(&token.ID)
+	if err != nil {
+		return fmt.Errorf("create oauth token: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// RotateToken меняет пару токенов по refresh-токену и продлевает сессию
+func (r *OAuthRepository) RotateToken(clientID int, refreshHash string, token *models.OAuthToken) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	token.ClientID = clientID
+	err = tx.QueryRow(
+		rotateOAuthTokenQuery,
+		refreshHash,
+		clientID,
+		token.AccessTokenHash,
+		token.RefreshTokenHash,
+		token.AccessExpiresAt,
+	).Scan(&token.ID, &token.SessionID, &token.UserID, pq.Array(&token.Scopes))
+	if err == sql.ErrNoRows {
+		return ErrOAuthTokenNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("rotate oauth token: %w", err)
+	}
+
+	if _, err := tx.Exec(extendOAuthSessionQuery, token.SessionID, token.RefreshExpiresAt); err != nil {
+		return fmt.Errorf("extend session: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (r *OAuthRepository) UseAccessToken(accessHash string) (*models.OAuthToken, error) {
+	token := &models.OAuthToken{AccessTokenHash: accessHash}
+	err := r.db.QueryRow(useOAuthTokenQuery, accessHash).Scan(
+		&token.ID,
+		&token.SessionID,
+		&token.ClientID,
+		&token.UserID,
+		pq.Array(&token.Scopes),
+		&token.AccessExpiresAt,
+		&token.RefreshExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrOAuthTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("use oauth token: %w", err)
+	}
+	return token, nil
+}
+
+func (r *OAuthRepository) FindToken(tokenHash string) (*models.OAuthToken, error) {
+	token := &models.OAuthToken{}
+	err := r.db.QueryRow(findOAuthTokenQuery, tokenHash).Scan(
+		&token.ID,
+		&token.SessionID,
+		&token.ClientID,
+		&token.UserID,
+		&token.AccessTokenHash,
+		&token.RefreshTokenHash,
+		pq.Array(&token.Scopes),
+		&token.AccessExpiresAt,
+		&token.RefreshExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrOAuthTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find oauth token: %w", err)
+	}
+	return token, nil
+}
+
+func (r *OAuthRepository) RevokeToken(clientID int, tokenHash string) error {
+	if _, err := r.db.Exec(revokeOAuthTokenQuery, clientID, tokenHash); err != nil {
+		return fmt.Errorf("revoke oauth token: %w", err)
+	}
+	return nil
+}
+
+func scanOAuthClient(row rowScanner) (*models.OAuthClient, error) {
+	client := &models.OAuthClient{}
+	err := row.Scan(
+		&client.ID,
+		&client.ClientID,
+		&client.ClientSecretHash,
+		&client.Name,
+		&client.OwnerID,
+		pq.Array(&client.RedirectURIs),
+		&client.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	client.Confidential = client.ClientSecretHash != ""
+	return client, nil
+}
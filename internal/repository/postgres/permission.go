@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"social-network/internal/models"
+
+	"github.com/lib/pq"
+)
+
+const (
+	listPermissionsQuery = `
+        SELECT name, description, privileged
+        FROM permissions
+        ORDER BY name`
+
+	listRolePermissionsQuery = `
+        SELECT role, permission
+        FROM role_permissions
+        ORDER BY role, permission`
+
+	deleteRolePermissionsQuery = `DELETE FROM role_permissions WHERE role = $1`
+
+	insertRolePermissionsQuery = `
+        INSERT INTO role_permissions (role, permission)
+        SELECT $1, unnest($2::text[])`
+)
+
+type PermissionRepository struct {
+	db *sql.DB
+}
+
+func NewPermissionRepository(db *sql.DB) *PermissionRepository {
+	return &PermissionRepository{db: db}
+}
+
+func (r *PermissionRepository) GetPermissions() ([]models.Permission, error) {
+	rows, err := r.db.Query(listPermissionsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("query permissions: %w", err)
+	}
+	defer rows.Close()
+
+	var permissions []models.Permission
+	for rows.Next() {
+		var permission models.Permission
+		if err := rows.Scan(&permission.Name, &permission.Description, &permission.Privileged); err != nil {
+			return nil, fmt.Errorf("scan permission: %w", err)
+		}
+		permissions = append(permissions, permission)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+
+	return permissions, nil
+}
+
+// GetRolePermissions возвращает всю матрицу: роль -> список прав
+func (r *PermissionRepository) GetRolePermissions() (map[models.UserRole][]string, error) {
+	rows, err := r.db.Query(listRolePermissionsQuery)
+	if err != nil {
+		return nil, fmt.Errorf("query role permissions: %w", err)
+	}
+	defer rows.Close()
+
+	matrix := make(map[models.UserRole][]string)
+	for rows.Next() {
+		var (
+			role       models.UserRole
+			permission string
+		)
+		if err := rows.Scan(&role, &permission); err != nil {
+			return nil, fmt.Errorf("scan role permission: %w", err)
+		}
+		matrix[role] = append(matrix[role], permission)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+
+	return matrix, nil
+}
+
+// SetRolePermissions заменяет права роли целиком
+func (r *PermissionRepository) SetRolePermissions(role models.UserRole, permissions []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(deleteRolePermissionsQuery, role); err != nil {
+		return fmt.Errorf("delete role permissions: %w", err)
+	}
+
+	if _, err := tx.Exec(insertRolePermissionsQuery, role, pq.Array(permissions)); err != nil {
+		return fmt.Errorf("insert role permissions: %w", err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,157 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"social-network/internal/models"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrPollNotFound      = errors.New("poll not found")
+	ErrPollClosed        = errors.New("poll is closed")
+	ErrAlreadyVoted      = errors.New("already voted")
+	ErrInvalidPollOption = errors.New("invalid poll option")
+)
+
+const (
+	createPollQuery = `
+        INSERT INTO polls (post_id, multiple_choice, closes_at)
+        VALUES ($1, $2, $3)
+        RETURNING id`
+
+	createPollOptionQuery = `
+        INSERT INTO poll_options (poll_id, position, text)
+        VALUES ($1, $2, $3)
+        RETURNING id`
+
+	// Срок сверяется в том же запросе, что записывает голос. Опрос
+	// закрывается только по времени, а CURRENT_TIMESTAMP - время начала
+	// транзакции, поэтому голос либо принят до закрытия, либо не записан.
+	createVoteQuery = `
+        INSERT INTO poll_votes (poll_id, user_id)
+        SELECT id, $2
+        FROM polls
+        WHERE id = $1 AND closes_at > CURRENT_TIMESTAMP`
+
+	pollExistsQuery = `SELECT EXISTS (SELECT 1 FROM polls WHERE id = $1)`
+
+	createVoteOptionsQuery = `
+        INSERT INTO poll_vote_options (poll_id, user_id, option_id)
+        SELECT $1, $2, po.id
+        FROM poll_options po
+        WHERE po.poll_id = $1 AND po.id = ANY($3)`
+
+	// Опрос поста для basePostColumns, в формате models.Poll. Результаты
+	// видны только проголосовавшим и после закрытия опроса.
+	postPollColumn = `
+               (
+                   SELECT json_build_object(
+                       'id', pl.id,
+                       'multiple_choice', pl.multiple_choice,
+                       'closes_at', pl.closes_at,
+                       'closed', pl.closes_at <= CURRENT_TIMESTAMP,
+                       'voted', pv.user_id IS NOT NULL,
+                       'voter_count', CASE WHEN pr.revealed
+                           THEN (SELECT COUNT(*) FROM poll_votes v WHERE v.poll_id = pl.id) END,
+                       'options', (
+                           SELECT json_agg(json_build_object(
+                               'id', po.id,
+                               'text', po.text,
+                               'votes', CASE WHEN pr.revealed
+                                   THEN (SELECT COUNT(*) FROM poll_vote_options vo WHERE vo.option_id = po.id) END,
+                               'voted_by_me', EXISTS (
+                                   SELECT 1 FROM poll_vote_options vo
+                                   WHERE vo.option_id = po.id AND vo.user_id = $1
+                               )
+                           ) ORDER BY po.position)
+                           FROM poll_options po WHERE po.poll_id = pl.id
+                       )
+                   )
+                   FROM polls pl
+                   LEFT JOIN poll_votes pv ON pv.poll_id = pl.id AND pv.user_id = $1
+                   CROSS JOIN LATERAL (
+                       SELECT pv.user_id IS NOT NULL OR pl.closes_at <= CURRENT_TIMESTAMP AS revealed
+                   ) pr
+                   WHERE pl.post_id = p.id
+               ) AS poll`
+)
+
+type PollRepository struct {
+	db *sql.DB
+}
+
+func NewPollRepository(db *sql.DB) *PollRepository {
+	return &PollRepository{db: db}
+}
+
+// Vote записывает голос одной транзакцией: либо сохраняются все
+// выбранные варианты, либо ни один. optionIDs не должны повторяться.
+func (r *PollRepository) Vote(pollID, userID int, optionIDs []int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(createVoteQuery, pollID, userID)
+	if err != nil {
+		if isPgDuplicateError(err) {
+			return ErrAlreadyVoted
+		}
+		return fmt.Errorf("create vote: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get affected rows: %w", err)
+	}
+
+	// Голос не записан: опроса нет или он закрыт
+	if rowsAffected == 0 {
+		var exists bool
+		if err := tx.QueryRow(pollExistsQuery, pollID).Scan(&exists); err != nil {
+			return fmt.Errorf("check poll: %w", err)
+		}
+		if !exists {
+			return ErrPollNotFound
+		}
+		return ErrPollClosed
+	}
+
+	result, err = tx.Exec(createVoteOptionsQuery, pollID, userID, pq.Array(optionIDs))
+	if err != nil {
+		return fmt.Errorf("create vote options: %w", err)
+	}
+
+	rowsAffected, err = result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get affected rows: %w", err)
+	}
+
+	// Вариант не из этого опроса
+	if rowsAffected != int64(len(optionIDs)) {
+		return ErrInvalidPollOption
+	}
+
+	return tx.Commit()
+}
+
+// createPoll сохраняет опрос нового поста и проставляет id вариантов
+func createPoll(tx *sql.Tx, postID int, poll *models.Poll) error {
+	err := tx.QueryRow(createPollQuery, postID, poll.MultipleChoice, poll.ClosesAt).Scan(&poll.ID)
+	if err != nil {
+		return fmt.Errorf("create poll: %w", err)
+	}
+
+	for i := range poll.Options {
+		err := tx.QueryRow(createPollOptionQuery, poll.ID, i+1, poll.Options[i].Text).Scan(&poll.Options[i].ID)
+		if err != nil {
+			return fmt.Errorf("create poll option: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -2,9 +2,11 @@ package postgres
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"social-network/internal/models"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -12,61 +14,145 @@ import (
 var (
 	ErrPostNotFound = errors.New("post not found")
 	ErrInvalidPage  = errors.New("invalid page number")
+	// Пост изменили после того, как его прочитал редактор
+	ErrVersionMismatch = errors.New("post version mismatch")
+	ErrPostPublished   = errors.New("post is already published")
+	ErrTooManyPins     = errors.New("too many pinned posts")
 )
 
+// Сколько постов автор может закрепить в профиле
+const MaxPinnedPosts = 3
+
 const (
-	// Базовые запросы для выборки постов
-	basePostSelect = `
+	// Базовая выборка постов, $1 - id читателя (0 - аноним).
+	// Счетчики считаются на лету, поэтому удаление постов и пользователей
+	// не может их рассинхронизировать. За колонками следует атрибуция
+	// репоста (см. postQuery), затем basePostFrom.
+	basePostColumns = `
         SELECT p.id, p.author_id, p.content, p.created_at, p.updated_at,
+               p.parent_id, p.root_id, p.reply_to_user_id,
+               p.quote_of_id, p.is_quote, p.last_editor_id, p.edit_count,
+               p.status, p.publish_at, p.visibility, p.pinned_at IS NOT NULL AS pinned,
+               (
+                   SELECT COUNT(*) FROM posts r
+                   WHERE r.parent_id = p.id AND r.status = 'published' AND ` + replyAudience + `
+               ) AS reply_count,
+               (SELECT COUNT(*) FROM post_likes l WHERE l.post_id = p.id) AS like_count,
+               EXISTS (
+                   SELECT 1 FROM post_likes l WHERE l.post_id = p.id AND l.user_id = $1
+               ) AS liked_by_me,
+               (SELECT COUNT(*) FROM reposts rp WHERE rp.post_id = p.id) AS repost_count,
+               EXISTS (
+                   SELECT 1 FROM reposts rp WHERE rp.post_id = p.id AND rp.user_id = $1
+               ) AS reposted_by_me,
+               EXISTS (
+                   SELECT 1 FROM bookmarks bm WHERE bm.post_id = p.id AND bm.user_id = $1
+               ) AS bookmarked_by_me,
+               ARRAY(
+                   SELECT mu.username FROM post_mentions pm
+                   JOIN users mu ON mu.id = pm.user_id
+                   WHERE pm.post_id = p.id
+                   ORDER BY mu.username
+               ) AS mentions,` + postMediaColumn + `,` + postPollColumn + `,
                u.username, u.role,
-               ARRAY_AGG(h.name) FILTER (WHERE h.name IS NOT NULL) as hashtags
+               ARRAY_AGG(h.name) FILTER (WHERE h.name IS NOT NULL) as hashtags`
+
+	basePostFrom = `
         FROM posts p
         JOIN users u ON p.author_id = u.id
         LEFT JOIN post_hashtags ph ON p.id = ph.post_id
         LEFT JOIN hashtags h ON ph.hashtag_id = h.id`
 
-	baseUserPostsQuery = basePostSelect + `
-        WHERE p.author_id = $1
-        GROUP BY p.id, u.id`
-
-	baseUserPostsQueryHashtag = `
-		SELECT p.id, p.author_id, p.content, p.created_at, p.updated_at,
-			u.username, u.role,
-			ARRAY_AGG(h.name) FILTER (WHERE h.name IS NOT NULL) as hashtags
-		FROM posts p
-		JOIN users u ON p.author_id = u.id
-		LEFT JOIN post_hashtags ph ON p.id = ph.post_id
-		LEFT JOIN hashtags h ON ph.hashtag_id = h.id
-		WHERE p.author_id = $1
-		GROUP BY p.id, u.id
-		HAVING $4::varchar IS NULL OR $4 = ANY(ARRAY_AGG(h.name) FILTER (WHERE h.name IS NOT NULL))`
-
-	baseFeedPostsQuery = basePostSelect + `
-        JOIN followers f ON p.author_id = f.following_id
-        WHERE f.follower_id = $1
-        GROUP BY p.id, u.id`
-
-	baseFeedPostsQueryHashtag = `
-		SELECT p.id, p.author_id, p.content, p.created_at, p.updated_at,
-			u.username, u.role,
-			ARRAY_AGG(h.name) FILTER (WHERE h.name IS NOT NULL) as hashtags
-		FROM posts p
-		JOIN users u ON p.author_id = u.id
-		LEFT JOIN post_hashtags ph ON p.id = ph.post_id
-		LEFT JOIN hashtags h ON ph.hashtag_id = h.id
-		JOIN followers f ON p.author_id = f.following_id
-		WHERE f.follower_id = $1
-		GROUP BY p.id, u.id
-		HAVING $4::varchar IS NULL OR $4 = ANY(ARRAY_AGG(h.name) FILTER (WHERE h.name IS NOT NULL))`
-
-	baseHashtagPostsQuery = basePostSelect + `
-        WHERE h.name = $1
-        GROUP BY p.id, u.id`
+	// Лента: свои посты подписок и их репосты. Пост, который репостнули
+	// несколько подписок, попадает в ленту один раз - с последним репостом.
+	// $1 - читатель, он же подписчик.
+	feedCTE = `
+        WITH feed AS (
+            SELECT DISTINCT ON (post_id) post_id, feed_at, reposted_by
+            FROM (
+                SELECT p.id AS post_id, p.created_at AS feed_at, NULL::integer AS reposted_by
+                FROM posts p
+                JOIN followers f ON p.author_id = f.following_id
+                WHERE f.follower_id = $1 AND ` + feedReplyFilter + `
+                UNION ALL
+                SELECT rp.post_id, rp.created_at, rp.user_id
+                FROM reposts rp
+                JOIN followers f ON rp.user_id = f.following_id
+                WHERE f.follower_id = $1
+            ) entries
+            ORDER BY post_id, feed_at DESC
+        )`
+
+	// Ответ попадает в ленту, только если читатель подписан на обоих
+	// участников разговора или сам в нем участвует
+	feedReplyFilter = `(
+            NOT p.is_reply
+            OR p.reply_to_user_id = $1
+            OR EXISTS (
+                SELECT 1 FROM followers rf
+                WHERE rf.follower_id = $1 AND rf.following_id = p.reply_to_user_id
+            )
+        )`
+
+	// Посты, которые может читать $1: свои, публичные, посты для
+	// подписчиков от тех, на кого он подписан, и посты, где он упомянут
+	postAudience = `(
+            p.author_id = $1
+            OR p.visibility = 'public'
+            OR (p.visibility = 'followers' AND EXISTS (
+                SELECT 1 FROM followers af
+                WHERE af.follower_id = $1 AND af.following_id = p.author_id
+            ))
+            OR (p.visibility = 'mentioned' AND EXISTS (
+                SELECT 1 FROM post_mentions am
+                WHERE am.post_id = p.id AND am.user_id = $1
+            ))
+        )`
+
+	// То же, что postAudience, для ответа r: счетчик ответов не должен
+	// выдавать ответы, которые читатель не увидит в ветке
+	replyAudience = `(
+                r.author_id = $1
+                OR r.visibility = 'public'
+                OR (r.visibility = 'followers' AND EXISTS (
+                    SELECT 1 FROM followers rf
+                    WHERE rf.follower_id = $1 AND rf.following_id = r.author_id
+                ))
+                OR (r.visibility = 'mentioned' AND EXISTS (
+                    SELECT 1 FROM post_mentions rm
+                    WHERE rm.post_id = r.id AND rm.user_id = $1
+                ))
+            )`
+
+	// Все потомки поста в порядке обхода дерева в глубину
+	threadRepliesCTE = `
+        WITH RECURSIVE thread AS (
+            SELECT id, ARRAY[id] AS path
+            FROM posts
+            WHERE parent_id = %s
+            UNION ALL
+            SELECT c.id, t.path || c.id
+            FROM posts c
+            JOIN thread t ON c.parent_id = t.id
+        )`
+
+	// Цепочка родителей от непосредственного родителя вверх до корня ветки
+	threadAncestorsCTE = `
+        WITH RECURSIVE ancestors AS (
+            SELECT parent_id AS id, 1 AS depth
+            FROM posts
+            WHERE id = %s AND parent_id IS NOT NULL
+            UNION ALL
+            SELECT p.parent_id, a.depth + 1
+            FROM posts p
+            JOIN ancestors a ON p.id = a.id
+            WHERE p.parent_id IS NOT NULL
+        )`
 
 	// Запросы для создания и обновления
 	createPostQuery = `
-        INSERT INTO posts (author_id, content)
-        VALUES ($1, $2)
+        INSERT INTO posts (author_id, content, parent_id, root_id, reply_to_user_id, is_reply, quote_of_id, is_quote, last_editor_id, status, publish_at, visibility)
+        VALUES ($1, $2, $3, $4, $5, $3::integer IS NOT NULL, $6, $6::integer IS NOT NULL, $1, $7, $8, $9)
         RETURNING id, created_at, updated_at`
 
 	insertHashtagsQuery = `
@@ -79,13 +165,83 @@ const (
         SELECT $1, id FROM hashtags 
         WHERE name = ANY($2)`
 
+	// Несуществующие имена просто не находятся в users
+	linkMentionsQuery = `
+        INSERT INTO post_mentions (post_id, user_id)
+        SELECT $1, id FROM users
+        WHERE username = ANY($2)
+        ON CONFLICT DO NOTHING`
+
+	// Текущая версия уходит в post_revisions тем же запросом. Строка
+	// блокируется, и версия (одна из $4, NULL - без проверки) сверяется уже
+	// под блокировкой, поэтому из двух параллельных правок пройдет одна.
 	updatePostQuery = `
-        UPDATE posts 
-        SET content = $1, updated_at = CURRENT_TIMESTAMP
-        WHERE id = $2
-        RETURNING updated_at`
+        WITH old AS (
+            SELECT id, edit_count + 1 AS version, content, last_editor_id, updated_at
+            FROM posts
+            WHERE id = $3 AND ($4::integer[] IS NULL OR edit_count + 1 = ANY($4::integer[]))
+            FOR UPDATE
+        ), saved AS (
+            INSERT INTO post_revisions (post_id, version, content, editor_id, created_at)
+            SELECT id, version, content, last_editor_id, updated_at FROM old
+        )
+        UPDATE posts
+        SET content = $1, last_editor_id = $2, edit_count = edit_count + 1, updated_at = CURRENT_TIMESTAMP
+        WHERE id IN (SELECT id FROM old)
+        RETURNING updated_at, edit_count`
+
+	postExistsQuery = `SELECT EXISTS (SELECT 1 FROM posts WHERE id = $1)`
 
 	deletePostQuery = `DELETE FROM posts WHERE id = $1`
+
+	likePostQuery = `
+        INSERT INTO post_likes (post_id, user_id)
+        VALUES ($1, $2)
+        ON CONFLICT DO NOTHING`
+
+	unlikePostQuery = `DELETE FROM post_likes WHERE post_id = $1 AND user_id = $2`
+
+	repostQuery = `
+        INSERT INTO reposts (user_id, post_id)
+        VALUES ($1, $2)
+        ON CONFLICT DO NOTHING`
+
+	unrepostQuery = `DELETE FROM reposts WHERE user_id = $1 AND post_id = $2`
+
+	// Перевод между черновиком и запланированным постом
+	schedulePostQuery = `
+        UPDATE posts
+        SET status = $2, publish_at = $3
+        WHERE id = $1 AND status <> 'published'`
+
+	// Публикация. Условие на статус защищает от двойной публикации,
+	// если пост одновременно публикуют вручную и по расписанию.
+	publishPostQuery = `
+        UPDATE posts
+        SET status = 'published', created_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+        WHERE id = $1 AND status <> 'published'
+        RETURNING created_at`
+
+	// Закрепление с публичным постом снимается при любой другой видимости
+	setVisibilityQuery = `
+        UPDATE posts
+        SET visibility = $2, pinned_at = CASE WHEN $2 = 'public' THEN pinned_at END
+        WHERE id = $1`
+
+	// Блокировка автора упорядочивает одновременные закрепления, иначе
+	// оба могли бы пройти проверку лимита
+	lockAuthorQuery = `SELECT id FROM users WHERE id = $1 FOR UPDATE`
+
+	countPinsQuery = `
+        SELECT COUNT(*) FROM posts
+        WHERE author_id = $1 AND pinned_at IS NOT NULL AND id <> $2`
+
+	pinPostQuery = `
+        UPDATE posts
+        SET pinned_at = COALESCE(pinned_at, CURRENT_TIMESTAMP)
+        WHERE id = $2 AND author_id = $1 AND status = 'published' AND visibility = 'public'`
+
+	unpinPostQuery = `UPDATE posts SET pinned_at = NULL WHERE id = $1`
 )
 
 type PostRepository struct {
@@ -108,97 +264,269 @@ func (r *PostRepository) Create(post *models.Post) error {
 		createPostQuery,
 		post.AuthorID,
 		post.Content,
+		post.ParentID,
+		post.RootID,
+		post.ReplyToUserID,
+		post.QuoteOfID,
+		post.Status,
+		post.PublishAt,
+		post.Visibility,
 	).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
 	if err != nil {
+		if isPgForeignKeyError(err) {
+			return ErrPostNotFound
+		}
 		return fmt.Errorf("create post: %w", err)
 	}
+	post.IsQuote = post.QuoteOfID != nil
+	post.Version = 1
 
-	// Обрабатываем хэштеги
-	if err := r.handleHashtags(tx, post.ID, post.Hashtags); err != nil {
-		return err
+	if len(post.Media) > 0 {
+		publicIDs := make([]string, len(post.Media))
+		for i, media := range post.Media {
+			publicIDs[i] = media.PublicID
+		}
+		if post.Media, err = attachMedia(tx, post.ID, post.AuthorID, publicIDs); err != nil {
+			return err
+		}
+	}
+
+	if post.Poll != nil {
+		if err := createPoll(tx, post.ID, post.Poll); err != nil {
+			return err
+		}
+	}
+
+	// Хэштеги и упоминания черновика свяжутся при публикации
+	if post.Status == models.PostStatusPublished {
+		if err := r.linkContent(tx, post); err != nil {
+			return err
+		}
 	}
 
 	return tx.Commit()
 }
 
-func (r *PostRepository) GetByID(postID int) (*models.Post, error) {
-	post := &models.Post{
-		Author: &models.User{},
+// Schedule планирует неопубликованный пост на publishAt или, если
+// publishAt == nil, возвращает его в черновики
+func (r *PostRepository) Schedule(postID int, publishAt *time.Time) error {
+	status := models.PostStatusDraft
+	if publishAt != nil {
+		status = models.PostStatusScheduled
 	}
 
-	query := basePostSelect + ` WHERE p.id = $1 GROUP BY p.id, u.id`
-	err := r.db.QueryRow(query, postID).Scan(
-		&post.ID,
-		&post.AuthorID,
-		&post.Content,
-		&post.CreatedAt,
-		&post.UpdatedAt,
-		&post.Author.Username,
-		&post.Author.Role,
-		pq.Array(&post.Hashtags),
-	)
+	result, err := r.db.Exec(schedulePostQuery, postID, status, publishAt)
+	if err != nil {
+		return fmt.Errorf("schedule post: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get affected rows: %w", err)
+	}
 
+	if rowsAffected == 0 {
+		return ErrPostPublished
+	}
+
+	return nil
+}
+
+func (r *PostRepository) SetVisibility(postID int, visibility string) error {
+	result, err := r.db.Exec(setVisibilityQuery, postID, visibility)
+	if err != nil {
+		return fmt.Errorf("set post visibility: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrPostNotFound
+	}
+
+	return nil
+}
+
+// Pin закрепляет публичный пост автора. Повторное закрепление ничего не
+// меняет, сверх MaxPinnedPosts возвращается ErrTooManyPins.
+func (r *PostRepository) Pin(postID, authorID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(lockAuthorQuery, authorID); err != nil {
+		return fmt.Errorf("lock author: %w", err)
+	}
+
+	var pinned int
+	if err := tx.QueryRow(countPinsQuery, authorID, postID).Scan(&pinned); err != nil {
+		return fmt.Errorf("count pins: %w", err)
+	}
+	if pinned >= MaxPinnedPosts {
+		return ErrTooManyPins
+	}
+
+	result, err := tx.Exec(pinPostQuery, authorID, postID)
+	if err != nil {
+		return fmt.Errorf("pin post: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrPostNotFound
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostRepository) Unpin(postID int) error {
+	if _, err := r.db.Exec(unpinPostQuery, postID); err != nil {
+		return fmt.Errorf("unpin post: %w", err)
+	}
+	return nil
+}
+
+// Publish публикует пост и связывает его хэштеги и упоминания
+func (r *PostRepository) Publish(post *models.Post) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(publishPostQuery, post.ID).Scan(&post.CreatedAt)
 	if err == sql.ErrNoRows {
-		return nil, ErrPostNotFound
+		return ErrPostPublished
 	}
 	if err != nil {
-		return nil, fmt.Errorf("query post: %w", err)
+		return fmt.Errorf("publish post: %w", err)
 	}
+	post.Status = models.PostStatusPublished
+	post.UpdatedAt = post.CreatedAt
 
-	return post, nil
+	if err := r.linkContent(tx, post); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (r *PostRepository) GetUserPosts(userID int, page, perPage int, orderDesc bool, hashtag *string) ([]models.Post, error) {
+// GetDrafts - черновики и запланированные посты автора
+func (r *PostRepository) GetDrafts(userID int, page, perPage int) ([]models.Post, error) {
 	if err := validatePagination(page, perPage); err != nil {
 		return nil, err
 	}
 
-	offset := (page - 1) * perPage
+	q := newPostQuery(userID)
+	q.visibility = "p.status <> 'published' AND p.author_id = $1"
+	q.order("p.publish_at ASC NULLS LAST, p.created_at DESC, p.id DESC").paginate(page, perPage)
 
-	var rows *sql.Rows
-	var err error
-	if hashtag == nil {
-		query := buildPaginatedQuery(baseUserPostsQuery, orderDesc)
-		rows, err = r.db.Query(query, userID, perPage, offset)
-	} else {
-		query := buildPaginatedQuery(baseUserPostsQueryHashtag, orderDesc)
-		rows, err = r.db.Query(query, userID, perPage, offset, hashtag)
-	}
+	return r.queryPosts(q, "query drafts")
+}
+
+// GetDuePosts - запланированные посты, время публикации которых наступило,
+// по порядку после (afterPublishAt, afterID). Курсор нужен, чтобы пост,
+// который не удается опубликовать, не возвращался в каждой пачке.
+func (r *PostRepository) GetDuePosts(afterPublishAt time.Time, afterID, limit int) ([]models.Post, error) {
+	q := newPostQuery(0)
+	q.visibility = "p.status = 'scheduled' AND p.publish_at <= CURRENT_TIMESTAMP"
+	q.audience = ""
+	q.filter("(p.publish_at, p.id) > (" + q.arg(afterPublishAt) + "::timestamptz, " + q.arg(afterID) + "::integer)")
+	q.order("p.publish_at, p.id")
+	q.limit = "LIMIT " + q.arg(limit)
+
+	return r.queryPosts(q, "query due posts")
+}
+
+// GetByID возвращает опубликованный пост, доступный читателю, или
+// неопубликованный пост самого читателя
+func (r *PostRepository) GetByID(postID, viewerID int) (*models.Post, error) {
+	q := newPostQuery(viewerID)
+	q.visibility = "(p.status = 'published' OR p.author_id = $1)"
+	q.filter("p.id = " + q.arg(postID))
+
+	return r.queryPost(q)
+}
+
+// GetForModeration - как GetByID, но без учета аудитории: править и
+// удалять чужие посты модератор может, даже если они ему не видны.
+// Права проверяет вызывающий.
+func (r *PostRepository) GetForModeration(postID, userID int) (*models.Post, error) {
+	q := newPostQuery(userID)
+	q.visibility = "(p.status = 'published' OR p.author_id = $1)"
+	q.audience = ""
+	q.filter("p.id = " + q.arg(postID))
 
+	return r.queryPost(q)
+}
+
+func (r *PostRepository) queryPost(q *postQuery) (*models.Post, error) {
+	query, args := q.build()
+	post, err := scanPost(r.db.QueryRow(query, args...))
+	if err == sql.ErrNoRows {
+		return nil, ErrPostNotFound
+	}
 	if err != nil {
-		return nil, fmt.Errorf("query posts: %w", err)
+		return nil, fmt.Errorf("query post: %w", err)
 	}
-	defer rows.Close()
 
-	return r.scanPosts(rows)
+	return post, nil
 }
 
-func (r *PostRepository) GetFeedPosts(userID int, page, perPage int, orderDesc bool, hashtag *string) ([]models.Post, error) {
+func (r *PostRepository) GetUserPosts(userID, viewerID int, page, perPage int, orderDesc bool, hashtag *string) ([]models.Post, error) {
 	if err := validatePagination(page, perPage); err != nil {
 		return nil, err
 	}
 
-	offset := (page - 1) * perPage
+	q := newPostQuery(viewerID)
+	q.filter("p.author_id = " + q.arg(userID))
+	if hashtag != nil {
+		q.hashtag(*hashtag)
+	}
+	// Закрепленные посты идут первыми при любом порядке остальных
+	q.newestFirst(orderDesc)
+	q.orderBy = "p.pinned_at DESC NULLS LAST, " + q.orderBy
+	q.paginate(page, perPage)
+
+	return r.queryPosts(q, "query posts")
+}
 
-	var rows *sql.Rows
-	var err error
-	if hashtag == nil {
-		query := buildPaginatedQuery(baseFeedPostsQuery, orderDesc)
-		rows, err = r.db.Query(query, userID, perPage, offset)
-	} else {
-		query := buildPaginatedQuery(baseFeedPostsQueryHashtag, orderDesc)
-		rows, err = r.db.Query(query, userID, perPage, offset, hashtag)
+func (r *PostRepository) GetFeedPosts(userID int, page, perPage int, orderDesc bool, hashtag *string) ([]models.Post, error) {
+	if err := validatePagination(page, perPage); err != nil {
+		return nil, err
 	}
 
-	if err != nil {
-		return nil, fmt.Errorf("query feed: %w", err)
+	q := newPostQuery(userID)
+	q.with = feedCTE
+	q.join("JOIN feed fe ON fe.post_id = p.id")
+	q.join("LEFT JOIN users ru ON ru.id = fe.reposted_by")
+	q.attribution = "ru.username, CASE WHEN fe.reposted_by IS NOT NULL THEN fe.feed_at END"
+	q.groupBy = []string{"fe.feed_at", "fe.reposted_by", "ru.username"}
+	if hashtag != nil {
+		q.hashtag(*hashtag)
 	}
-	defer rows.Close()
+	if orderDesc {
+		q.order("fe.feed_at DESC, p.id DESC")
+	} else {
+		q.order("fe.feed_at ASC, p.id ASC")
+	}
+	q.paginate(page, perPage)
 
-	return r.scanPosts(rows)
+	return r.queryPosts(q, "query feed")
 }
 
-func (r *PostRepository) Update(post *models.Post) error {
+// Update сохраняет новый текст поста. Если expectedVersions не nil, правка
+// применяется, только пока версия поста - одна из ожидаемых.
+func (r *PostRepository) Update(post *models.Post, expectedVersions []int) error {
 	tx, err := r.db.Begin()
 	if err != nil {
 		return fmt.Errorf("begin transaction: %w", err)
@@ -206,13 +534,27 @@ func (r *PostRepository) Update(post *models.Post) error {
 	defer tx.Rollback()
 
 	// Обновляем пост
-	err = tx.QueryRow(updatePostQuery, post.Content, post.ID).Scan(&post.UpdatedAt)
+	err = tx.QueryRow(updatePostQuery, post.Content, post.LastEditorID, post.ID, pq.Array(expectedVersions)).Scan(&post.UpdatedAt, &post.EditCount)
 	if err == sql.ErrNoRows {
+		var exists bool
+		if err := tx.QueryRow(postExistsQuery, post.ID).Scan(&exists); err != nil {
+			return fmt.Errorf("check post: %w", err)
+		}
+		if exists {
+			return ErrVersionMismatch
+		}
 		return ErrPostNotFound
 	}
 	if err != nil {
 		return fmt.Errorf("update post: %w", err)
 	}
+	post.Edited = true
+	post.Version = post.EditCount + 1
+
+	// У черновика связей нет, они появятся при публикации
+	if post.Status != models.PostStatusPublished {
+		return tx.Commit()
+	}
 
 	// Удаляем старые хэштеги
 	_, err = tx.Exec("DELETE FROM post_hashtags WHERE post_id = $1", post.ID)
@@ -220,8 +562,13 @@ func (r *PostRepository) Update(post *models.Post) error {
 		return fmt.Errorf("delete old hashtags: %w", err)
 	}
 
-	// Добавляем новые хэштеги
-	if err := r.handleHashtags(tx, post.ID, post.Hashtags); err != nil {
+	// Упоминания пересобираем так же
+	_, err = tx.Exec("DELETE FROM post_mentions WHERE post_id = $1", post.ID)
+	if err != nil {
+		return fmt.Errorf("delete old mentions: %w", err)
+	}
+
+	if err := r.linkContent(tx, post); err != nil {
 		return err
 	}
 
@@ -266,27 +613,35 @@ func (r *PostRepository) handleHashtags(tx *sql.Tx, postID int, hashtags []strin
 	return nil
 }
 
+// linkContent связывает пост с его хэштегами и упоминаниями
+func (r *PostRepository) linkContent(tx *sql.Tx, post *models.Post) error {
+	if err := r.handleHashtags(tx, post.ID, post.Hashtags); err != nil {
+		return err
+	}
+	return r.handleMentions(tx, post.ID, post.Mentions)
+}
+
+func (r *PostRepository) handleMentions(tx *sql.Tx, postID int, usernames []string) error {
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	if _, err := tx.Exec(linkMentionsQuery, postID, pq.Array(usernames)); err != nil {
+		return fmt.Errorf("link mentions: %w", err)
+	}
+
+	return nil
+}
+
 func (r *PostRepository) scanPosts(rows *sql.Rows) ([]models.Post, error) {
 	var posts []models.Post
 	for rows.Next() {
-		var post models.Post
-		post.Author = &models.User{}
-
-		err := rows.Scan(
-			&post.ID,
-			&post.AuthorID,
-			&post.Content,
-			&post.CreatedAt,
-			&post.UpdatedAt,
-			&post.Author.Username,
-			&post.Author.Role,
-			pq.Array(&post.Hashtags),
-		)
+		post, err := scanPost(rows)
 		if err != nil {
 			return nil, fmt.Errorf("scan post: %w", err)
 		}
 
-		posts = append(posts, post)
+		posts = append(posts, *post)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -296,53 +651,202 @@ func (r *PostRepository) scanPosts(rows *sql.Rows) ([]models.Post, error) {
 	return posts, nil
 }
 
-func (r *PostRepository) GetPostsByHashtag(hashtag string, searchType string, username string, page, perPage int, orderDesc bool) ([]models.Post, error) {
+func (r *PostRepository) queryPosts(q *postQuery, action string) ([]models.Post, error) {
+	query, args := q.build()
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", action, err)
+	}
+	defer rows.Close()
+
+	return r.scanPosts(rows)
+}
+
+func (r *PostRepository) GetPostsByHashtag(hashtag string, searchType string, username string, viewerID int, page, perPage int, orderDesc bool) ([]models.Post, error) {
 	if err := validatePagination(page, perPage); err != nil {
 		return nil, err
 	}
 
-	var baseQuery string
-	var args []interface{}
-	args = append(args, hashtag)
+	q := newPostQuery(viewerID)
+	q.hashtag(hashtag)
 
 	switch searchType {
 	case models.SearchTypeUser:
-		baseQuery = basePostSelect + `
-            WHERE h.name = $1 AND u.username = $2
-            GROUP BY p.id, u.id`
-		args = append(args, username)
+		q.filter("u.username = " + q.arg(username))
 	case models.SearchTypeFollowing:
-		baseQuery = basePostSelect + `
-            JOIN followers f ON p.author_id = f.following_id
-            WHERE h.name = $1 AND f.follower_id = $2
-            GROUP BY p.id, u.id`
-		args = append(args, username)
-	default: // SearchTypeAll
-		baseQuery = baseHashtagPostsQuery
+		q.join("JOIN followers f ON p.author_id = f.following_id")
+		q.filter("f.follower_id = (SELECT id FROM users WHERE username = " + q.arg(username) + ")")
 	}
+	q.newestFirst(orderDesc).paginate(page, perPage)
 
-	query := buildPaginatedQuery(baseQuery, orderDesc)
-	args = append(args, perPage, (page-1)*perPage)
+	return r.queryPosts(q, "query hashtag posts")
+}
 
-	rows, err := r.db.Query(query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("query hashtag posts: %w", err)
+// GetThreadReplies возвращает страницу потомков поста в порядке обхода
+// дерева в глубину: каждый ответ идет сразу после своего родителя
+func (r *PostRepository) GetThreadReplies(postID, viewerID int, page, perPage int) ([]models.Post, error) {
+	if err := validatePagination(page, perPage); err != nil {
+		return nil, err
 	}
-	defer rows.Close()
 
-	return r.scanPosts(rows)
+	q := newPostQuery(viewerID)
+	q.with = fmt.Sprintf(threadRepliesCTE, q.arg(postID))
+	q.join("JOIN thread t ON t.id = p.id")
+	q.groupBy = []string{"t.path"}
+	q.order("t.path").paginate(page, perPage)
+
+	return r.queryPosts(q, "query thread replies")
 }
 
-func buildPaginatedQuery(baseQuery string, orderDesc bool) string {
-	orderBy := "ASC"
-	if orderDesc {
-		orderBy = "DESC"
+func (r *PostRepository) GetThreadAncestors(postID, viewerID int) ([]models.Post, error) {
+	q := newPostQuery(viewerID)
+	q.with = fmt.Sprintf(threadAncestorsCTE, q.arg(postID))
+	q.join("JOIN ancestors a ON a.id = p.id")
+	q.groupBy = []string{"a.depth"}
+	q.order("a.depth DESC")
+
+	return r.queryPosts(q, "query thread ancestors")
+}
+
+// GetLikedPosts - посты, которые лайкнул пользователь, свежие лайки первыми
+func (r *PostRepository) GetLikedPosts(userID, viewerID int, page, perPage int) ([]models.Post, error) {
+	if err := validatePagination(page, perPage); err != nil {
+		return nil, err
 	}
-	return fmt.Sprintf(`
-        %s
-        ORDER BY p.created_at %s
-        LIMIT $2 OFFSET $3
-    `, baseQuery, orderBy)
+
+	q := newPostQuery(viewerID)
+	q.join("JOIN post_likes ul ON ul.post_id = p.id AND ul.user_id = " + q.arg(userID))
+	q.groupBy = []string{"ul.created_at"}
+	q.order("ul.created_at DESC, p.id DESC").paginate(page, perPage)
+
+	return r.queryPosts(q, "query liked posts")
+}
+
+// GetMentions - посты, в которых упомянут пользователь
+func (r *PostRepository) GetMentions(userID int, page, perPage int, orderDesc bool) ([]models.Post, error) {
+	if err := validatePagination(page, perPage); err != nil {
+		return nil, err
+	}
+
+	q := newPostQuery(userID)
+	q.join("JOIN post_mentions m ON m.post_id = p.id AND m.user_id = $1")
+	q.newestFirst(orderDesc).paginate(page, perPage)
+
+	return r.queryPosts(q, "query mentions")
+}
+
+// GetBookmarks - закладки пользователя, свежие первыми. collectionID
+// оставляет только одну подборку. Пост, который перестал быть виден
+// пользователю, из выдачи пропадает, но закладка сохраняется.
+func (r *PostRepository) GetBookmarks(userID int, collectionID *int, page, perPage int) ([]models.Post, error) {
+	if err := validatePagination(page, perPage); err != nil {
+		return nil, err
+	}
+
+	q := newPostQuery(userID)
+	q.join("JOIN bookmarks ub ON ub.post_id = p.id AND ub.user_id = $1")
+	if collectionID != nil {
+		q.filter("ub.collection_id = " + q.arg(*collectionID))
+	}
+	q.groupBy = []string{"ub.created_at"}
+	q.order("ub.created_at DESC, p.id DESC").paginate(page, perPage)
+
+	return r.queryPosts(q, "query bookmarks")
+}
+
+// Like идемпотентен: повторный лайк ничего не меняет
+func (r *PostRepository) Like(postID, userID int) error {
+	if _, err := r.db.Exec(likePostQuery, postID, userID); err != nil {
+		if isPgForeignKeyError(err) {
+			return ErrPostNotFound
+		}
+		return fmt.Errorf("like post: %w", err)
+	}
+	return nil
+}
+
+func (r *PostRepository) Unlike(postID, userID int) error {
+	if _, err := r.db.Exec(unlikePostQuery, postID, userID); err != nil {
+		return fmt.Errorf("unlike post: %w", err)
+	}
+	return nil
+}
+
+// Repost идемпотентен, как и Like
+func (r *PostRepository) Repost(postID, userID int) error {
+	if _, err := r.db.Exec(repostQuery, userID, postID); err != nil {
+		if isPgForeignKeyError(err) {
+			return ErrPostNotFound
+		}
+		return fmt.Errorf("repost: %w", err)
+	}
+	return nil
+}
+
+func (r *PostRepository) Unrepost(postID, userID int) error {
+	if _, err := r.db.Exec(unrepostQuery, userID, postID); err != nil {
+		return fmt.Errorf("delete repost: %w", err)
+	}
+	return nil
+}
+
+// scanPost читает basePostColumns и атрибуцию; extra - колонки
+// postQuery.columns, если они есть
+func scanPost(row rowScanner, extra ...interface{}) (*models.Post, error) {
+	post := &models.Post{
+		Author: &models.User{},
+	}
+	var mediaJSON, pollJSON []byte
+
+	dest := []interface{}{
+		&post.ID,
+		&post.AuthorID,
+		&post.Content,
+		&post.CreatedAt,
+		&post.UpdatedAt,
+		&post.ParentID,
+		&post.RootID,
+		&post.ReplyToUserID,
+		&post.QuoteOfID,
+		&post.IsQuote,
+		&post.LastEditorID,
+		&post.EditCount,
+		&post.Status,
+		&post.PublishAt,
+		&post.Visibility,
+		&post.Pinned,
+		&post.ReplyCount,
+		&post.LikeCount,
+		&post.LikedByMe,
+		&post.RepostCount,
+		&post.RepostedByMe,
+		&post.BookmarkedByMe,
+		pq.Array(&post.Mentions),
+		&mediaJSON,
+		&pollJSON,
+		&post.Author.Username,
+		&post.Author.Role,
+		pq.Array(&post.Hashtags),
+		&post.RepostedBy,
+		&post.RepostedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(mediaJSON, &post.Media); err != nil {
+		return nil, fmt.Errorf("decode media: %w", err)
+	}
+	if pollJSON != nil {
+		if err := json.Unmarshal(pollJSON, &post.Poll); err != nil {
+			return nil, fmt.Errorf("decode poll: %w", err)
+		}
+	}
+
+	post.Author.ID = post.AuthorID
+	post.Edited = post.EditCount > 0
+	post.Version = post.EditCount + 1
+	return post, nil
 }
 
 func validatePagination(page, perPage int) error {
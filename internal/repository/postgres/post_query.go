@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+)
+
+// postQuery собирает выборку постов из basePostColumns и basePostFrom.
+// Параметры нумеруются по мере добавления, поэтому условия можно свободно
+// комбинировать. $1 всегда занят читателем: от него зависят поля вроде
+// liked_by_me и то, какие посты ему можно показать.
+type postQuery struct {
+	with string
+	// visibility - какие посты вообще можно показать. По умолчанию только
+	// опубликованные, чтобы черновики не попали ни в одну выборку случайно.
+	visibility string
+	// audience - посты, которые доступны читателю (см. postAudience).
+	// Пустое условие только у системных выборок без читателя.
+	audience string
+	// attribution - колонки reposted_by и reposted_at, вне ленты пустые
+	attribution string
+	// columns - дополнительные колонки после атрибуции, их читает
+	// вызывающий (см. scanPost)
+	columns []string
+	joins   []string
+	where   []string
+	groupBy []string
+	orderBy string
+	limit   string
+	args    []interface{}
+}
+
+func newPostQuery(viewerID int) *postQuery {
+	return &postQuery{
+		visibility: "p.status = 'published'",
+		audience:   postAudience,
+		args:       []interface{}{viewerID},
+	}
+}
+
+// arg добавляет параметр и возвращает его плейсхолдер
+func (q *postQuery) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+func (q *postQuery) join(clause string) *postQuery {
+	q.joins = append(q.joins, clause)
+	return q
+}
+
+func (q *postQuery) filter(condition string) *postQuery {
+	q.where = append(q.where, condition)
+	return q
+}
+
+// hashtag оставляет посты с хэштегом, не теряя остальные хэштеги поста
+func (q *postQuery) hashtag(name string) *postQuery {
+	return q.filter(`EXISTS (
+            SELECT 1 FROM post_hashtags fph
+            JOIN hashtags fh ON fh.id = fph.hashtag_id
+            WHERE fph.post_id = p.id AND fh.name = ` + q.arg(name) + `
+        )`)
+}
+
+func (q *postQuery) order(orderBy string) *postQuery {
+	q.orderBy = orderBy
+	return q
+}
+
+// newestFirst - обычный порядок лент
+func (q *postQuery) newestFirst(desc bool) *postQuery {
+	if desc {
+		return q.order("p.created_at DESC, p.id DESC")
+	}
+	return q.order("p.created_at ASC, p.id ASC")
+}
+
+func (q *postQuery) paginate(page, perPage int) *postQuery {
+	q.limit = fmt.Sprintf("LIMIT %s OFFSET %s", q.arg(perPage), q.arg((page-1)*perPage))
+	return q
+}
+
+func (q *postQuery) build() (string, []interface{}) {
+	var sb strings.Builder
+	sb.WriteString(q.with)
+	sb.WriteString(basePostColumns)
+	sb.WriteString(",\n               ")
+	if q.attribution != "" {
+		sb.WriteString(q.attribution)
+	} else {
+		sb.WriteString("NULL::text, NULL::timestamptz")
+	}
+	for _, column := range q.columns {
+		sb.WriteString(",\n               ")
+		sb.WriteString(column)
+	}
+	sb.WriteString(basePostFrom)
+	for _, join := range q.joins {
+		sb.WriteString("\n        ")
+		sb.WriteString(join)
+	}
+	sb.WriteString("\n        WHERE ")
+	conditions := []string{q.visibility}
+	if q.audience != "" {
+		conditions = append(conditions, q.audience)
+	}
+	sb.WriteString(strings.Join(append(conditions, q.where...), "\n        AND "))
+	sb.WriteString("\n        GROUP BY ")
+	sb.WriteString(strings.Join(append([]string{"p.id", "u.id"}, q.groupBy...), ", "))
+	if q.orderBy != "" {
+		sb.WriteString("\n        ORDER BY ")
+		sb.WriteString(q.orderBy)
+	}
+	if q.limit != "" {
+		sb.WriteString("\n        ")
+		sb.WriteString(q.limit)
+	}
+	return sb.String(), q.args
+}
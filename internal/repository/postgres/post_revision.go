@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"social-network/internal/models"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+const (
+	listRevisionsQuery = `
+        SELECT r.version, r.content, r.editor_id, u.username, r.created_at
+        FROM post_revisions r
+        LEFT JOIN users u ON u.id = r.editor_id
+        WHERE r.post_id = $1
+        ORDER BY r.version`
+
+	getRevisionQuery = `
+        SELECT r.version, r.content, r.editor_id, u.username, r.created_at
+        FROM post_revisions r
+        LEFT JOIN users u ON u.id = r.editor_id
+        WHERE r.post_id = $1 AND r.version = $2`
+)
+
+// GetRevisions возвращает прежние версии поста, от первой к последней.
+// Текущая версия хранится в posts и сюда не входит.
+func (r *PostRepository) GetRevisions(postID int) ([]models.PostRevision, error) {
+	rows, err := r.db.Query(listRevisionsQuery, postID)
+	if err != nil {
+		return nil, fmt.Errorf("query revisions: %w", err)
+	}
+	defer rows.Close()
+
+	var revisions []models.PostRevision
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan revision: %w", err)
+		}
+		revisions = append(revisions, *revision)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+
+	return revisions, nil
+}
+
+func (r *PostRepository) GetRevision(postID, version int) (*models.PostRevision, error) {
+	revision, err := scanRevision(r.db.QueryRow(getRevisionQuery, postID, version))
+	if err == sql.ErrNoRows {
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query revision: %w", err)
+	}
+
+	return revision, nil
+}
+
+func scanRevision(row rowScanner) (*models.PostRevision, error) {
+	var revision models.PostRevision
+	err := row.Scan(
+		&revision.Version,
+		&revision.Content,
+		&revision.EditorID,
+		&revision.Editor,
+		&revision.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
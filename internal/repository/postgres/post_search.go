@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"fmt"
+	"html"
+	"social-network/internal/models"
+	"strings"
+)
+
+const (
+	// Метки совпадений в ts_headline. Текст поста не экранирован, поэтому
+	// метки заменяются на <mark> уже после экранирования, см. searchSnippet.
+	snippetStart = "{{mark}}"
+	snippetStop  = "{{/mark}}"
+
+	snippetOptions = "StartSel=" + snippetStart + ", StopSel=" + snippetStop +
+		", MaxWords=30, MinWords=10, MaxFragments=2"
+)
+
+// Search ищет посты по тексту (websearch_to_tsquery: слова, "фразы", OR,
+// -исключения) в обеих конфигурациях и по операторам запроса. С текстом
+// результаты идут по релевантности, без него - новые первыми.
+func (r *PostRepository) Search(search *models.PostSearch, viewerID int, page, perPage int) ([]models.Post, error) {
+	if err := validatePagination(page, perPage); err != nil {
+		return nil, err
+	}
+
+	query, args := newSearchQuery(search, viewerID).paginate(page, perPage).build()
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("search posts: %w", err)
+	}
+	defer rows.Close()
+
+	posts := []models.Post{}
+	for rows.Next() {
+		var snippet *string
+		post, err := scanPost(rows, &snippet)
+		if err != nil {
+			return nil, fmt.Errorf("scan post: %w", err)
+		}
+		if snippet != nil {
+			post.Snippet = searchSnippet(*snippet)
+		}
+		posts = append(posts, *post)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+
+	return posts, nil
+}
+
+// newSearchQuery - выборка для Search. Последняя колонка - фрагмент
+// с подсветкой, без текста запроса она пустая.
+func newSearchQuery(search *models.PostSearch, viewerID int) *postQuery {
+	q := newPostQuery(viewerID)
+	if search.Author != "" {
+		q.filter("u.username = " + q.arg(search.Author))
+	}
+	for _, hashtag := range search.Hashtags {
+		q.hashtag(hashtag)
+	}
+	if search.Since != nil {
+		q.filter("p.created_at >= " + q.arg(*search.Since))
+	}
+	if search.Until != nil {
+		q.filter("p.created_at < " + q.arg(*search.Until))
+	}
+
+	if search.Text == "" {
+		q.columns = []string{"NULL::text"}
+		q.newestFirst(true)
+	} else {
+		text := q.arg(search.Text)
+		tsquery := fmt.Sprintf("(websearch_to_tsquery('russian', %s) || websearch_to_tsquery('english', %s))", text, text)
+		q.filter("p.search_vector @@ " + tsquery)
+		// Русская конфигурация разбирает и латиницу (english_stem), поэтому
+		// подсвечивает слова на обоих языках
+		q.columns = []string{fmt.Sprintf("ts_headline('russian', p.content, %s, '%s')", tsquery, snippetOptions)}
+		q.order(fmt.Sprintf("ts_rank(p.search_vector, %s) DESC, p.created_at DESC, p.id DESC", tsquery))
+	}
+	return q
+}
+
+// searchSnippet экранирует фрагмент и превращает метки совпадений в <mark>
+func searchSnippet(headline string) string {
+	escaped := html.EscapeString(headline)
+	escaped = strings.ReplaceAll(escaped, snippetStart, "<mark>")
+	return strings.ReplaceAll(escaped, snippetStop, "</mark>")
+}
@@ -3,15 +3,39 @@ package postgres
 import "database/sql"
 
 type Repositories struct {
-	Users   *UserRepository
-	Posts   *PostRepository
-	Follows *FollowRepository
+	Users       *UserRepository
+	Posts       *PostRepository
+	Follows     *FollowRepository
+	Sessions    *SessionRepository
+	TwoFactor   *TwoFactorRepository
+	Lockouts    *LockoutRepository
+	Events      *SecurityEventRepository
+	Tokens      *AccessTokenRepository
+	OAuth       *OAuthRepository
+	Permissions *PermissionRepository
+	Locks       *LockRepository
+	Media       *MediaRepository
+	Polls       *PollRepository
+	Bookmarks   *BookmarkRepository
+	Trends      *HashtagTrendRepository
 }
 
 func NewRepositories(db *sql.DB) *Repositories {
 	return &Repositories{
-		Users:   NewUserRepository(db),
-		Posts:   NewPostRepository(db),
-		Follows: NewFollowRepository(db),
+		Users:       NewUserRepository(db),
+		Posts:       NewPostRepository(db),
+		Follows:     NewFollowRepository(db),
+		Sessions:    NewSessionRepository(db),
+		TwoFactor:   NewTwoFactorRepository(db),
+		Lockouts:    NewLockoutRepository(db),
+		Events:      NewSecurityEventRepository(db),
+		Tokens:      NewAccessTokenRepository(db),
+		OAuth:       NewOAuthRepository(db),
+		Permissions: NewPermissionRepository(db),
+		Locks:       NewLockRepository(db),
+		Media:       NewMediaRepository(db),
+		Polls:       NewPollRepository(db),
+		Bookmarks:   NewBookmarkRepository(db),
+		Trends:      NewHashtagTrendRepository(db),
 	}
 }
@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"social-network/internal/models"
+)
+
+const (
+	createSecurityEventQuery = `
+        INSERT INTO security_events (event_type, user_id, ip, details)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, created_at`
+)
+
+type SecurityEventRepository struct {
+	db *sql.DB
+}
+
+func NewSecurityEventRepository(db *sql.DB) *SecurityEventRepository {
+	return &SecurityEventRepository{db: db}
+}
+
+func (r *SecurityEventRepository) Create(event *models.SecurityEvent) error {
+	err := r.db.QueryRow(
+		createSecurityEventQuery,
+		event.Type,
+		event.UserID,
+		event.IP,
+		event.Details,
+	).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("create security event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"social-network/internal/models"
+	"time"
+)
+
+var (
+	ErrSessionNotFound      = errors.New("session not found")
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenReused   = errors.New("refresh token reused")
+)
+
+const (
+	createSessionQuery = `
+        INSERT INTO sessions (token_hash, user_id, user_agent, ip, expires_at)
+        VALUES (NULLIF($1, ''), $2, $3, $4, $5)
+        RETURNING id, created_at, last_seen_at`
+
+	// Продлеваем сессию только если она еще не истекла
+	touchSessionQuery = `
+        UPDATE sessions
+        SET last_seen_at = CURRENT_TIMESTAMP, expires_at = $2
+        WHERE token_hash = $1 AND expires_at > CURRENT_TIMESTAMP
+        RETURNING id, user_id, user_agent, ip, created_at, last_seen_at, expires_at`
+
+	deleteSessionByTokenQuery = `DELETE FROM sessions WHERE token_hash = $1`
+
+	sessionActiveQuery = `
+        SELECT EXISTS (
+            SELECT 1 FROM sessions WHERE id = $1 AND expires_at > CURRENT_TIMESTAMP
+        )`
+
+	deleteExpiredSessionsQuery = `DELETE FROM sessions WHERE expires_at <= CURRENT_TIMESTAMP`
+
+	createRefreshTokenQuery = `
+        INSERT INTO refresh_tokens (session_id, token_hash, expires_at)
+        VALUES ($1, $2, $3)`
+
+	selectRefreshTokenQuery = `
+        SELECT id, session_id, expires_at, used_at
+        FROM refresh_tokens
+        WHERE token_hash = $1
+        FOR UPDATE`
+
+	useRefreshTokenQuery = `
+        UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = $1`
+
+	extendSessionQuery = `
+        UPDATE sessions
+        SET last_seen_at = CURRENT_TIMESTAMP, expires_at = $2
+        WHERE id = $1
+        RETURNING user_id, user_agent, ip, created_at, last_seen_at, expires_at`
+
+	deleteSessionQuery = `DELETE FROM sessions WHERE id = $1`
+
+	listUserSessionsQuery = `
+        SELECT id, user_id, user_agent, ip, created_at, last_seen_at, expires_at
+        FROM sessions
+        WHERE user_id = $1 AND expires_at > CURRENT_TIMESTAMP
+        ORDER BY last_seen_at DESC`
+
+	deleteUserSessionQuery = `DELETE FROM sessions WHERE id = $1 AND user_id = $2`
+
+	deleteAllUserSessionsQuery = `DELETE FROM sessions WHERE user_id = $1`
+)
+
+type SessionRepository struct {
+	db *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+func (r *SessionRepository) Create(session *models.Session) error {
+	err := r.db.QueryRow(
+		createSessionQuery,
+		session.TokenHash,
+		session.UserID,
+		session.UserAgent,
+		session.IP,
+		session.ExpiresAt,
+	).Scan(&session.ID, &session.CreatedAt, &session.LastSeenAt)
+	if err != nil {
+		return fmt.Errorf("create session: %w", err)
+	}
+	return nil
+}
+
+func (r *SessionRepository) Touch(tokenHash string, expiresAt time.Time) (*models.Session, error) {
+	session := &models.Session{TokenHash: tokenHash}
+	err := r.db.QueryRow(touchSessionQuery, tokenHash, expiresAt).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.UserAgent,
+		&session.IP,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.ExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("touch session: %w", err)
+	}
+	return session, nil
+}
+
+func (r *SessionRepository) DeleteByTokenHash(tokenHash string) error {
+	if _, err := r.db.Exec(deleteSessionByTokenQuery, tokenHash); err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return nil
+}
+
+func (r *SessionRepository) IsActive(sessionID int) (bool, error) {
+	var active bool
+	if err := r.db.QueryRow(sessionActiveQuery, sessionID).Scan(&active); err != nil {
+		return false, fmt.Errorf("check session: %w", err)
+	}
+	return active, nil
+}
+
+func (r *SessionRepository) DeleteExpired() (int64, error) {
+	result, err := r.db.Exec(deleteExpiredSessionsQuery)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired sessions: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("get affected rows: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+func (r *SessionRepository) CreateFamily(session *models.Session, tokenHash string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(
+		createSessionQuery,
+		session.TokenHash,
+		session.UserID,
+		session.UserAgent,
+		session.IP,
+		session.ExpiresAt,
+	).Scan(&session.ID, &session.CreatedAt, &session.LastSeenAt)
+	if err != nil {
+		return fmt.Errorf("create session: %w", err)
+	}
+
+	_, err = tx.Exec(createRefreshTokenQuery, session.ID, tokenHash, session.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("create refresh token: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (r *SessionRepository) Rotate(oldHash, newHash string, expiresAt time.Time) (*models.Session, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var (
+		tokenID        int
+		sessionID      int
+		tokenExpiresAt time.Time
+		usedAt         sql.NullTime
+	)
+	err = tx.QueryRow(selectRefreshTokenQuery, oldHash).Scan(&tokenID, &sessionID, &tokenExpiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select refresh token: %w", err)
+	}
+
+	// Токен уже был обменян - считаем семью скомпрометированной
+	if usedAt.Valid {
+		if _, err := tx.Exec(deleteSessionQuery, sessionID); err != nil {
+			return nil, fmt.Errorf("revoke token family: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	if time.Now().After(tokenExpiresAt) {
+		return nil, ErrRefreshTokenNotFound
+	}
+
+	if _, err := tx.Exec(useRefreshTokenQuery, tokenID); err != nil {
+		return nil, fmt.Errorf("use refresh token: %w", err)
+	}
+
+	if _, err := tx.Exec(createRefreshTokenQuery, sessionID, newHash, expiresAt); err != nil {
+		return nil, fmt.Errorf("create refresh token: %w", err)
+	}
+
+	session := &models.Session{ID: sessionID}
+	err = tx.QueryRow(extendSessionQuery, sessionID, expiresAt).Scan(
+		&session.UserID,
+		&session.UserAgent,
+		&session.IP,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.ExpiresAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("extend session: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (r *SessionRepository) GetUserSessions(userID int) ([]models.Session, error) {
+	rows, err := r.db.Query(listUserSessionsQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.UserAgent,
+			&session.IP,
+			&session.CreatedAt,
+			&session.LastSeenAt,
+			&session.ExpiresAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+
+	return sessions, nil
+}
+
+func (r *SessionRepository) DeleteUserSession(userID, sessionID int) error {
+	result, err := r.db.Exec(deleteUserSessionQuery, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+func (r *SessionRepository) DeleteAllUserSessions(userID int) error {
+	if _, err := r.db.Exec(deleteAllUserSessionsQuery, userID); err != nil {
+		return fmt.Errorf("delete sessions: %w", err)
+	}
+	return nil
+}
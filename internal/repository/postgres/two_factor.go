@@ -0,0 +1,221 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrInvalidRecoveryCode = errors.New("invalid recovery code")
+	ErrTOTPCodeReused      = errors.New("totp code already used")
+	ErrChallengeNotFound   = errors.New("login challenge not found")
+)
+
+// Сколько раз можно ввести неверный код на одном шаге входа
+const maxChallengeAttempts = 5
+
+const (
+	setTOTPSecretQuery = `
+        UPDATE users
+        SET totp_secret = $2, totp_enabled = FALSE, updated_at = CURRENT_TIMESTAMP
+        WHERE id = $1`
+
+	enableTOTPQuery = `
+        UPDATE users
+        SET totp_enabled = TRUE, totp_last_step = $2, updated_at = CURRENT_TIMESTAMP
+        WHERE id = $1`
+
+	disableTOTPQuery = `
+        UPDATE users
+        SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = 0, updated_at = CURRENT_TIMESTAMP
+        WHERE id = $1`
+
+	// Шаг принимается, только если он новее последнего использованного
+	useTOTPStepQuery = `
+        UPDATE users
+        SET totp_last_step = $2
+        WHERE id = $1 AND totp_last_step < $2`
+
+	deleteRecoveryCodesQuery = `DELETE FROM recovery_codes WHERE user_id = $1`
+
+	insertRecoveryCodesQuery = `
+        INSERT INTO recovery_codes (user_id, code_hash)
+        SELECT $1, unnest($2::text[])`
+
+	useRecoveryCodeQuery = `
+        UPDATE recovery_codes
+        SET used_at = CURRENT_TIMESTAMP
+        WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+	createChallengeQuery = `
+        INSERT INTO login_challenges (token_hash, user_id, expires_at)
+        VALUES ($1, $2, $3)`
+
+	attemptChallengeQuery = `
+        UPDATE login_challenges
+        SET attempts = attempts + 1
+        WHERE token_hash = $1 AND expires_at > CURRENT_TIMESTAMP AND attempts < $2
+        RETURNING user_id`
+
+	deleteChallengeQuery = `
+        DELETE FROM login_challenges
+        WHERE token_hash = $1 OR expires_at <= CURRENT_TIMESTAMP`
+)
+
+type TwoFactorRepository struct {
+	db *sql.DB
+}
+
+func NewTwoFactorRepository(db *sql.DB) *TwoFactorRepository {
+	return &TwoFactorRepository{db: db}
+}
+
+// SetSecret сохраняет секрет, который еще нужно подтвердить кодом
+func (r *TwoFactorRepository) SetSecret(userID int, secret string) error {
+	result, err := r.db.Exec(setTOTPSecretQuery, userID, secret)
+	if err != nil {
+		return fmt.Errorf("set totp secret: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// Enable включает 2FA и заменяет коды восстановления
+func (r *TwoFactorRepository) Enable(userID int, step int64, codeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(enableTOTPQuery, userID, step); err != nil {
+		return fmt.Errorf("enable totp: %w", err)
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *TwoFactorRepository) Disable(userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(disableTOTPQuery, userID); err != nil {
+		return fmt.Errorf("disable totp: %w", err)
+	}
+
+	if _, err := tx.Exec(deleteRecoveryCodesQuery, userID); err != nil {
+		return fmt.Errorf("delete recovery codes: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (r *TwoFactorRepository) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *TwoFactorRepository) UseTOTPStep(userID int, step int64) error {
+	result, err := r.db.Exec(useTOTPStepQuery, userID, step)
+	if err != nil {
+		return fmt.Errorf("use totp step: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrTOTPCodeReused
+	}
+
+	return nil
+}
+
+func (r *TwoFactorRepository) UseRecoveryCode(userID int, codeHash string) error {
+	result, err := r.db.Exec(useRecoveryCodeQuery, userID, codeHash)
+	if err != nil {
+		return fmt.Errorf("use recovery code: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("get affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrInvalidRecoveryCode
+	}
+
+	return nil
+}
+
+func (r *TwoFactorRepository) CreateChallenge(userID int, tokenHash string, expiresAt time.Time) error {
+	if _, err := r.db.Exec(createChallengeQuery, tokenHash, userID, expiresAt); err != nil {
+		return fmt.Errorf("create login challenge: %w", err)
+	}
+	return nil
+}
+
+// AttemptChallenge засчитывает попытку ввода кода и возвращает владельца
+func (r *TwoFactorRepository) AttemptChallenge(tokenHash string) (int, error) {
+	var userID int
+	err := r.db.QueryRow(attemptChallengeQuery, tokenHash, maxChallengeAttempts).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrChallengeNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("attempt login challenge: %w", err)
+	}
+	return userID, nil
+}
+
+// DeleteChallenge удаляет пройденный шаг входа и заодно все просроченные
+func (r *TwoFactorRepository) DeleteChallenge(tokenHash string) error {
+	if _, err := r.db.Exec(deleteChallengeQuery, tokenHash); err != nil {
+		return fmt.Errorf("delete login challenge: %w", err)
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec(deleteRecoveryCodesQuery, userID); err != nil {
+		return fmt.Errorf("delete recovery codes: %w", err)
+	}
+
+	if _, err := tx.Exec(insertRecoveryCodesQuery, userID, pq.Array(codeHashes)); err != nil {
+		return fmt.Errorf("insert recovery codes: %w", err)
+	}
+
+	return nil
+}
@@ -5,15 +5,24 @@ import (
 	"errors"
 	"fmt"
 	"social-network/internal/models"
+	"strings"
+	"time"
 
 	"github.com/lib/pq"
 )
 
 var (
-	ErrUserNotFound = errors.New("user not found")
-	ErrUserExists   = errors.New("user already exists")
+	ErrUserNotFound      = errors.New("user not found")
+	ErrUserExists        = errors.New("user already exists")
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
 )
 
+const baseUserSelect = `
+        SELECT id, username, COALESCE(email, ''), password_hash, role,
+               COALESCE(totp_secret, ''), totp_enabled, totp_last_step,
+               created_at, updated_at
+        FROM users`
+
 type UserRepository struct {
 	db *sql.DB
 }
@@ -24,8 +33,8 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 
 func (r *UserRepository) Create(user *models.User) error {
 	query := `
-        INSERT INTO users (username, password_hash, role)
-        VALUES ($1, crypt($2, gen_salt('bf')), $3)
+        INSERT INTO users (username, password_hash, role, email)
+        VALUES ($1, $2, $3, NULLIF($4, ''))
         RETURNING id, created_at, updated_at`
 
 	err := r.db.QueryRow(
@@ -33,6 +42,7 @@ func (r *UserRepository) Create(user *models.User) error {
 		user.Username,
 		user.PasswordHash,
 		user.Role,
+		user.Email,
 	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
@@ -44,22 +54,32 @@ func (r *UserRepository) Create(user *models.User) error {
 	return nil
 }
 
-func (r *UserRepository) ValidatePassword(username, password string) (*models.User, error) {
-	user := &models.User{}
-	query := `
-        SELECT id, username, role, created_at, updated_at
-        FROM users
-        WHERE username = $1 
-        AND password_hash = crypt($2, password_hash)`
+func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
+	return r.getUser(baseUserSelect+` WHERE username = $1`, username)
+}
 
-	err := r.db.QueryRow(query, username, password).Scan(
+func (r *UserRepository) GetByID(id int) (*models.User, error) {
+	return r.getUser(baseUserSelect+` WHERE id = $1`, id)
+}
+
+func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
+	return r.getUser(baseUserSelect+` WHERE email = $1`, email)
+}
+
+func (r *UserRepository) getUser(query string, args ...interface{}) (*models.User, error) {
+	user := &models.User{}
+	err := r.db.QueryRow(query, args...).Scan(
 		&user.ID,
 		&user.Username,
+		&user.Email,
+		&user.PasswordHash,
 		&user.Role,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.TOTPLastStep,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
-
 	if err == sql.ErrNoRows {
 		return nil, ErrUserNotFound
 	}
@@ -69,52 +89,88 @@ func (r *UserRepository) ValidatePassword(username, password string) (*models.Us
 	return user, nil
 }
 
-func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
-	user := &models.User{}
+func (r *UserRepository) UpdatePasswordHash(userID int, passwordHash string) error {
 	query := `
-        SELECT id, username, password_hash, role, created_at, updated_at
-        FROM users
-        WHERE username = $1`
+        UPDATE users
+        SET password_hash = $1, updated_at = CURRENT_TIMESTAMP
+        WHERE id = $2`
 
-	err := r.db.QueryRow(query, username).Scan(
-		&user.ID,
-		&user.Username,
-		&user.PasswordHash,
-		&user.Role,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, ErrUserNotFound
+	result, err := r.db.Exec(query, passwordHash, userID)
+	if err != nil {
+		return err
 	}
+
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return user, nil
+
+	if rowsAffected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
 }
 
-func (r *UserRepository) GetByID(id int) (*models.User, error) {
-	user := &models.User{}
-	query := `
-        SELECT id, username, password_hash, role, created_at, updated_at
-        FROM users
-        WHERE id = $1`
+// CreatePasswordReset сохраняет новый токен сброса, гася все предыдущие
+func (r *UserRepository) CreatePasswordReset(userID int, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
 
-	err := r.db.QueryRow(query, id).Scan(
-		&user.ID,
-		&user.Username,
-		&user.PasswordHash,
-		&user.Role,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	_, err = tx.Exec(`
+        UPDATE password_reset_tokens
+        SET used_at = CURRENT_TIMESTAMP
+        WHERE user_id = $1 AND used_at IS NULL`, userID)
+	if err != nil {
+		return fmt.Errorf("invalidate reset tokens: %w", err)
+	}
+
+	_, err = tx.Exec(`
+        INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+        VALUES ($1, $2, $3)`, userID, tokenHash, expiresAt)
+	if err != nil {
+		return fmt.Errorf("create reset token: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// ResetPassword гасит токен и меняет пароль в одной транзакции
+func (r *UserRepository) ResetPassword(tokenHash, passwordHash string) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRow(`
+        UPDATE password_reset_tokens
+        SET used_at = CURRENT_TIMESTAMP
+        WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+        RETURNING user_id`, tokenHash).Scan(&userID)
 	if err == sql.ErrNoRows {
-		return nil, ErrUserNotFound
+		return 0, ErrInvalidResetToken
 	}
 	if err != nil {
-		return nil, err
+		return 0, fmt.Errorf("use reset token: %w", err)
 	}
-	return user, nil
+
+	_, err = tx.Exec(`
+        UPDATE users
+        SET password_hash = $1, updated_at = CURRENT_TIMESTAMP
+        WHERE id = $2`, passwordHash, userID)
+	if err != nil {
+		return 0, fmt.Errorf("update password: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return userID, nil
 }
 
 func (r *UserRepository) Delete(userID int, withPosts bool) error {
@@ -231,6 +287,26 @@ func (r *UserRepository) GetFollowing(userID, page, perPage int) ([]models.User,
 	return r.scanUsers(rows)
 }
 
+// GetPostLikers - кто лайкнул пост, свежие лайки первыми
+func (r *UserRepository) GetPostLikers(postID, page, perPage int) ([]models.User, error) {
+	query := `
+        SELECT u.id, u.username, u.role, u.created_at, u.updated_at
+        FROM users u
+        JOIN post_likes l ON u.id = l.user_id
+        WHERE l.post_id = $1
+        ORDER BY l.created_at DESC, u.id
+        LIMIT $2 OFFSET $3`
+
+	offset := (page - 1) * perPage
+	rows, err := r.db.Query(query, postID, perPage, offset)
+	if err != nil {
+		return nil, fmt.Errorf("query post likers: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanUsers(rows)
+}
+
 func (r *UserRepository) GetMutualFollows(userID, page, perPage int) ([]models.User, error) {
 	query := `
         SELECT u.id, u.username, u.role, u.created_at, u.updated_at
@@ -251,6 +327,41 @@ func (r *UserRepository) GetMutualFollows(userID, page, perPage int) ([]models.U
 	return r.scanUsers(rows)
 }
 
+// Search ищет пользователей по началу имени и с опечатками (pg_trgm).
+// Порядок - смесь похожести имени, совпадения префикса, числа подписчиков
+// и того, подписан ли на пользователя ищущий. query - в нижнем регистре.
+func (r *UserRepository) Search(query string, viewerID, page, perPage int) ([]models.User, error) {
+	searchQuery := `
+        SELECT u.id, u.username, u.role, u.created_at, u.updated_at
+        FROM users u
+        CROSS JOIN LATERAL (
+            SELECT COUNT(*) AS followers FROM followers f WHERE f.following_id = u.id
+        ) fc
+        WHERE lower(u.username) LIKE $2 ESCAPE '\' OR lower(u.username) % $1
+        ORDER BY similarity(lower(u.username), $1)
+                 + CASE WHEN lower(u.username) LIKE $2 ESCAPE '\' THEN 0.5 ELSE 0 END
+                 + 0.1 * ln(1 + fc.followers)
+                 + CASE WHEN EXISTS (
+                       SELECT 1 FROM followers vf
+                       WHERE vf.follower_id = $3 AND vf.following_id = u.id
+                   ) THEN 0.3 ELSE 0 END DESC,
+                 u.username
+        LIMIT $4 OFFSET $5`
+
+	prefix := likeEscaper.Replace(query) + "%"
+	offset := (page - 1) * perPage
+	rows, err := r.db.Query(searchQuery, query, prefix, viewerID, perPage, offset)
+	if err != nil {
+		return nil, fmt.Errorf("search users: %w", err)
+	}
+	defer rows.Close()
+
+	return r.scanUsers(rows)
+}
+
+// likeEscaper экранирует спецсимволы LIKE в пользовательском вводе
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
 func (r *UserRepository) scanUsers(rows *sql.Rows) ([]models.User, error) {
 	var users []models.User
 	for rows.Next() {
@@ -274,3 +385,8 @@ func isPgDuplicateError(err error) bool {
 	pgErr, ok := err.(*pq.Error)
 	return ok && pgErr.Code == "23505"
 }
+
+func isPgForeignKeyError(err error) bool {
+	pgErr, ok := err.(*pq.Error)
+	return ok && pgErr.Code == "23503"
+}
@@ -0,0 +1,128 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUnknownHashFormat = errors.New("unknown password hash format")
+)
+
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify сверяет пароль с хэшем. needsRehash означает, что хэш
+	// посчитан устаревшим алгоритмом или параметрами и его стоит обновить.
+	Verify(password, encoded string) (ok bool, needsRehash bool, err error)
+}
+
+// Argon2Params - параметры Argon2id, Memory в КиБ
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params - рекомендации OWASP для Argon2id
+func DefaultArgon2Params() Argon2Params {
+	return Argon2Params{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+// Argon2idHasher хэширует пароли Argon2id в формате PHC:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>.
+// Старые bcrypt-хэши от pgcrypto тоже проверяются, но помечаются на перехэширование.
+type Argon2idHasher struct {
+	params Argon2Params
+}
+
+func NewArgon2idHasher(params Argon2Params) *Argon2idHasher {
+	return &Argon2idHasher{params: params}
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.params.Memory,
+		h.params.Iterations,
+		h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Verify(password, encoded string) (bool, bool, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return h.verifyArgon2id(password, encoded)
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, fmt.Errorf("verify bcrypt hash: %w", err)
+		}
+		return true, true, nil
+	default:
+		return false, false, ErrUnknownHashFormat
+	}
+}
+
+func (h *Argon2idHasher) verifyArgon2id(password, encoded string) (bool, bool, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, false, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, ErrUnknownHashFormat
+	}
+
+	var params Argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return false, false, ErrUnknownHashFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, ErrUnknownHashFormat
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, ErrUnknownHashFormat
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(expected))
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, expected) != 1 {
+		return false, false, nil
+	}
+
+	return true, params != h.params, nil
+}
@@ -0,0 +1,21 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// GenerateToken возвращает случайный токен из 32 байт в hex
+func GenerateToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// HashToken - хэш токена для хранения в БД. Токены высокоэнтропийные,
+// поэтому медленный хэш для них не нужен.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
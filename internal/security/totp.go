@@ -0,0 +1,100 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Параметры TOTP (RFC 6238) - значения по умолчанию, которые
+// понимают все приложения-аутентификаторы
+const (
+	totpDigits = 6
+	totpPeriod = 30
+	// Допускаем расхождение часов на один шаг в каждую сторону
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func GenerateTOTPSecret() string {
+	b := make([]byte, 20)
+	rand.Read(b)
+	return totpEncoding.EncodeToString(b)
+}
+
+// ValidateTOTP проверяет код и возвращает шаг времени, которому он
+// соответствует. Шаг нужен, чтобы не принимать один и тот же код дважды.
+func ValidateTOTP(secret, code string, at time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := at.Unix() / totpPeriod
+	for delta := int64(-totpSkew); delta <= totpSkew; delta++ {
+		step := current + delta
+		if hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// TOTPProvisioningURI - otpauth:// ссылка, которую клиент показывает QR-кодом
+func TOTPProvisioningURI(issuer, account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+
+	// Часть аутентификаторов не понимает "+" вместо пробела
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + strings.ReplaceAll(params.Encode(), "+", "%20")
+}
+
+// GenerateRecoveryCodes возвращает n одноразовых кодов вида xxxx-xxxx-xxxx-xxxx
+func GenerateRecoveryCodes(n int) []string {
+	codes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, 8)
+		rand.Read(b)
+		h := hex.EncodeToString(b)
+		codes[i] = h[0:4] + "-" + h[4:8] + "-" + h[8:12] + "-" + h[12:16]
+	}
+	return codes
+}
+
+// NormalizeRecoveryCode приводит введенный пользователем код к виду,
+// из которого считался хэш
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, " ", "")
+	code = strings.ReplaceAll(code, "-", "")
+	if len(code) != 16 {
+		return code
+	}
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+}
+
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"errors"
+	"social-network/internal/models"
+	"social-network/internal/repository/postgres"
+	"social-network/internal/security"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidScope     = errors.New("invalid token scope")
+	ErrInvalidTokenName = errors.New("token name must be between 1 and 100 characters")
+)
+
+// AccessTokenPrefix отличает персональные токены от токенов сессий
+const AccessTokenPrefix = "pat_"
+
+type AccessTokenService interface {
+	Create(userID int, name string, scopes []string, ttl time.Duration) (string, *models.PersonalAccessToken, error)
+	GetUserTokens(userID int) ([]models.PersonalAccessToken, error)
+	Revoke(userID, tokenID int) error
+	Authenticate(token string) (*models.PersonalAccessToken, error)
+}
+
+type AccessTokenServiceImpl struct {
+	repo *postgres.AccessTokenRepository
+}
+
+func NewAccessTokenService(repo *postgres.AccessTokenRepository) AccessTokenService {
+	return &AccessTokenServiceImpl{repo: repo}
+}
+
+// Create выпускает токен. Сам токен возвращается только здесь,
+// в БД остается его хэш. ttl == 0 - бессрочный токен.
+func (s *AccessTokenServiceImpl) Create(userID int, name string, scopes []string, ttl time.Duration) (string, *models.PersonalAccessToken, error) {
+	name = strings.TrimSpace(name)
+	if len(name) < 1 || len(name) > 100 {
+		return "", nil, ErrInvalidTokenName
+	}
+	if len(scopes) == 0 {
+		return "", nil, ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !isValidScope(scope) {
+			return "", nil, ErrInvalidScope
+		}
+	}
+
+	raw := AccessTokenPrefix + security.GenerateToken()
+	token := &models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: security.HashToken(raw),
+		Scopes:    scopes,
+	}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := s.repo.Create(token); err != nil {
+		return "", nil, err
+	}
+
+	return raw, token, nil
+}
+
+func (s *AccessTokenServiceImpl) GetUserTokens(userID int) ([]models.PersonalAccessToken, error) {
+	return s.repo.GetUserTokens(userID)
+}
+
+func (s *AccessTokenServiceImpl) Revoke(userID, tokenID int) error {
+	return s.repo.Delete(userID, tokenID)
+}
+
+func (s *AccessTokenServiceImpl) Authenticate(token string) (*models.PersonalAccessToken, error) {
+	return s.repo.Use(security.HashToken(token))
+}
+
+func isValidScope(scope string) bool {
+	for _, known := range models.Scopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
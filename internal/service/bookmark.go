@@ -0,0 +1,99 @@
+package service
+
+import (
+	"errors"
+	"social-network/internal/models"
+	"social-network/internal/repository/postgres"
+	"strings"
+	"unicode/utf8"
+)
+
+var ErrInvalidCollectionName = errors.New("collection name must be between 1 and 50 characters")
+
+// BookmarkService - приватные закладки. Пользователь работает только со
+// своими закладками; пользоваться ими вообще разрешает право bookmark.manage.
+type BookmarkService interface {
+	Add(postID, userID int, collectionID *int) error
+	Remove(postID, userID int) error
+	GetBookmarks(userID int, collectionID *int, page, perPage int) ([]models.Post, error)
+	CreateCollection(userID int, name string) (*models.BookmarkCollection, error)
+	GetCollections(userID int) ([]models.BookmarkCollection, error)
+	DeleteCollection(userID, collectionID int) error
+}
+
+type BookmarkServiceImpl struct {
+	repos  *postgres.Repositories
+	policy *Policy
+}
+
+func NewBookmarkService(repos *postgres.Repositories, policy *Policy) BookmarkService {
+	return &BookmarkServiceImpl{repos: repos, policy: policy}
+}
+
+// Add сохраняет пост в закладки или переносит в другую подборку.
+// Сохранить можно только опубликованный пост, который виден пользователю.
+func (s *BookmarkServiceImpl) Add(postID, userID int, collectionID *int) error {
+	if err := s.authorize(userID); err != nil {
+		return err
+	}
+	post, err := s.repos.Posts.GetByID(postID, userID)
+	if err != nil {
+		return err
+	}
+	if post.Status != models.PostStatusPublished {
+		return postgres.ErrPostNotFound
+	}
+	return s.repos.Bookmarks.Add(userID, postID, collectionID)
+}
+
+func (s *BookmarkServiceImpl) Remove(postID, userID int) error {
+	if err := s.authorize(userID); err != nil {
+		return err
+	}
+	return s.repos.Bookmarks.Remove(userID, postID)
+}
+
+func (s *BookmarkServiceImpl) GetBookmarks(userID int, collectionID *int, page, perPage int) ([]models.Post, error) {
+	if err := s.authorize(userID); err != nil {
+		return nil, err
+	}
+	return s.repos.Posts.GetBookmarks(userID, collectionID, page, perPage)
+}
+
+func (s *BookmarkServiceImpl) CreateCollection(userID int, name string) (*models.BookmarkCollection, error) {
+	if err := s.authorize(userID); err != nil {
+		return nil, err
+	}
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > 50 {
+		return nil, ErrInvalidCollectionName
+	}
+
+	collection := &models.BookmarkCollection{UserID: userID, Name: name}
+	if err := s.repos.Bookmarks.CreateCollection(collection); err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+func (s *BookmarkServiceImpl) GetCollections(userID int) ([]models.BookmarkCollection, error) {
+	if err := s.authorize(userID); err != nil {
+		return nil, err
+	}
+	return s.repos.Bookmarks.GetCollections(userID)
+}
+
+func (s *BookmarkServiceImpl) DeleteCollection(userID, collectionID int) error {
+	if err := s.authorize(userID); err != nil {
+		return err
+	}
+	return s.repos.Bookmarks.DeleteCollection(userID, collectionID)
+}
+
+func (s *BookmarkServiceImpl) authorize(userID int) error {
+	user, err := s.repos.Users.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	return s.policy.Authorize(user, models.PermBookmarkManage)
+}
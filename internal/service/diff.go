@@ -0,0 +1,63 @@
+package service
+
+import (
+	"social-network/internal/models"
+	"strings"
+)
+
+// diffWords сравнивает два текста по словам (наибольшая общая
+// подпоследовательность). Посты короткие, поэтому квадратичной
+// таблицы достаточно.
+func diffWords(before, after string) []models.DiffChunk {
+	a, b := strings.Fields(before), strings.Fields(after)
+
+	// lcs[i][j] - длина общей подпоследовательности a[i:] и b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var chunks []models.DiffChunk
+	add := func(op, word string) {
+		if n := len(chunks); n > 0 && chunks[n-1].Op == op {
+			chunks[n-1].Text += " " + word
+			return
+		}
+		chunks = append(chunks, models.DiffChunk{Op: op, Text: word})
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			add(models.DiffEqual, a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			add(models.DiffDelete, a[i])
+			i++
+		default:
+			add(models.DiffInsert, b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		add(models.DiffDelete, a[i])
+	}
+	for ; j < len(b); j++ {
+		add(models.DiffInsert, b[j])
+	}
+
+	return chunks
+}
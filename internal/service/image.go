@@ -0,0 +1,330 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+const (
+	thumbnailSize = 320
+	// Защита от "бомб": маленький файл с огромными размерами картинки.
+	// Для GIF считаются пиксели всех кадров вместе.
+	maxImagePixels = 40 * 1000 * 1000
+)
+
+var (
+	errImageTooLarge = errors.New("image dimensions too large")
+	errBrokenGIF     = errors.New("broken gif")
+)
+
+// processedImage - картинка без метаданных и ее превью в JPEG
+type processedImage struct {
+	data      []byte
+	thumbnail []byte
+	width     int
+	height    int
+}
+
+// processImage декодирует картинку и кодирует ее заново. Кодировщики
+// стандартной библиотеки пишут только пиксели, поэтому EXIF (в том числе
+// геометка), XMP, комментарии и прочие метаданные в результат не попадают.
+// Поворот из EXIF применяется к пикселям до того, как тег пропадет.
+func processImage(data []byte, contentType string) (*processedImage, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, errImageTooLarge
+	}
+	if contentType == "image/gif" {
+		pixels, err := gifFramePixels(data)
+		if err != nil {
+			return nil, err
+		}
+		if pixels > maxImagePixels {
+			return nil, errImageTooLarge
+		}
+	}
+
+	var (
+		buf   bytes.Buffer
+		first image.Image
+	)
+	width, height := config.Width, config.Height
+	switch contentType {
+	case "image/jpeg":
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		img = orient(img, exifOrientation(data))
+		width, height = img.Bounds().Dx(), img.Bounds().Dy()
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			return nil, err
+		}
+		first = img
+	case "image/png":
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		first = img
+	case "image/gif":
+		// Анимация сохраняется, пропадают только расширения с метаданными
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if err := gif.EncodeAll(&buf, anim); err != nil {
+			return nil, err
+		}
+		first = anim.Image[0]
+	default:
+		return nil, image.ErrFormat
+	}
+
+	thumbnail, err := makeThumbnail(first)
+	if err != nil {
+		return nil, err
+	}
+
+	return &processedImage{
+		data:      buf.Bytes(),
+		thumbnail: thumbnail,
+		width:     width,
+		height:    height,
+	}, nil
+}
+
+// makeThumbnail уменьшает картинку так, чтобы большая сторона была не
+// больше thumbnailSize, и кодирует в JPEG. Прозрачность заливается белым.
+func makeThumbnail(src image.Image) ([]byte, error) {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > thumbnailSize || height > thumbnailSize {
+		if width >= height {
+			width, height = thumbnailSize, max(1, height*thumbnailSize/width)
+		} else {
+			width, height = max(1, width*thumbnailSize/height), thumbnailSize
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	downscale(dst, src)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// downscale усредняет область исходной картинки под каждым пикселем
+// результата. Из большой области берется не больше 4x4 точек: для превью
+// этого достаточно, а время не зависит от размера оригинала.
+func downscale(dst *image.RGBA, src image.Image) {
+	const samples = 4
+
+	sb, db := src.Bounds(), dst.Bounds()
+	for y := 0; y < db.Dy(); y++ {
+		y0 := sb.Min.Y + y*sb.Dy()/db.Dy()
+		y1 := max(y0+1, sb.Min.Y+(y+1)*sb.Dy()/db.Dy())
+		for x := 0; x < db.Dx(); x++ {
+			x0 := sb.Min.X + x*sb.Dx()/db.Dx()
+			x1 := max(x0+1, sb.Min.X+(x+1)*sb.Dx()/db.Dx())
+
+			var r, g, b, a, n uint32
+			for sy := 0; sy < samples; sy++ {
+				py := y0 + (y1-y0)*sy/samples
+				for sx := 0; sx < samples; sx++ {
+					px := x0 + (x1-x0)*sx/samples
+					cr, cg, cb, ca := src.At(px, py).RGBA()
+					r, g, b, a, n = r+cr, g+cg, b+cb, a+ca, n+1
+				}
+			}
+
+			// Цвета RGBA() премультиплицированы, поэтому наложение на белый -
+			// это добавление белого в доле прозрачности
+			r, g, b, a = r/n, g/n, b/n, a/n
+			white := 0xffff - a
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8((r + white) >> 8),
+				G: uint8((g + white) >> 8),
+				B: uint8((b + white) >> 8),
+				A: 0xff,
+			})
+		}
+	}
+}
+
+// gifFramePixels складывает площади всех кадров GIF, не распаковывая их.
+// gif.DecodeAll выделяет память под каждый кадр, и тысяча сжатых кадров
+// на весь холст из маленького файла превращается в гигабайты.
+func gifFramePixels(data []byte) (int, error) {
+	if len(data) < 13 {
+		return 0, errBrokenGIF
+	}
+	pos := 13
+	// Глобальная палитра
+	if data[10]&0x80 != 0 {
+		pos += 3 << (data[10]&0x07 + 1)
+	}
+
+	// skipBlocks пропускает цепочку подблоков до нулевого
+	skipBlocks := func() bool {
+		for pos < len(data) {
+			size := int(data[pos])
+			pos++
+			if size == 0 {
+				return true
+			}
+			pos += size
+		}
+		return false
+	}
+
+	pixels := 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // расширение: метка и подблоки
+			pos += 2
+			if !skipBlocks() {
+				return 0, errBrokenGIF
+			}
+		case 0x2C: // кадр: дескриптор, палитра, размер кода LZW и данные
+			if pos+10 > len(data) {
+				return 0, errBrokenGIF
+			}
+			width := int(binary.LittleEndian.Uint16(data[pos+5:]))
+			height := int(binary.LittleEndian.Uint16(data[pos+7:]))
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			pos++
+			if !skipBlocks() {
+				return 0, errBrokenGIF
+			}
+			pixels += width * height
+			if pixels > maxImagePixels {
+				return pixels, nil
+			}
+		case 0x3B: // конец файла
+			return pixels, nil
+		default:
+			return 0, errBrokenGIF
+		}
+	}
+	return pixels, nil
+}
+
+// exifOrientation возвращает тег Orientation (1-8) из EXIF в JPEG. Если
+// тега нет или EXIF поврежден - 1, картинка как есть.
+func exifOrientation(data []byte) int {
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF; {
+		marker := data[pos+1]
+		size := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if marker == 0xDA || size < 2 || pos+2+size > len(data) {
+			break
+		}
+		segment := data[pos+4 : pos+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		pos += 2 + size
+	}
+	return 1
+}
+
+// tiffOrientation ищет тег Orientation в первом IFD заголовка TIFF
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		// 0x0112 - Orientation, тип SHORT
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orient поворачивает и отражает картинку так, как велит тег Orientation
+func orient(src image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	sb := src.Bounds()
+	w, h := sb.Dx(), sb.Dy()
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(rgba, rgba.Bounds(), src, sb.Min, draw.Src)
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			// Точка исходной картинки, которая попадает в (x, y)
+			var sx, sy int
+			switch orientation {
+			case 2: // отражение по горизонтали
+				sx, sy = w-1-x, y
+			case 3: // поворот на 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // отражение по вертикали
+				sx, sy = x, h-1-y
+			case 5: // отражение по главной диагонали
+				sx, sy = y, x
+			case 6: // поворот на 90 по часовой
+				sx, sy = y, h-1-x
+			case 7: // отражение по побочной диагонали
+				sx, sy = w-1-y, h-1-x
+			case 8: // поворот на 90 против часовой
+				sx, sy = w-1-y, x
+			}
+			si, di := rgba.PixOffset(sx, sy), dst.PixOffset(x, y)
+			copy(dst.Pix[di:di+4], rgba.Pix[si:si+4])
+		}
+	}
+	return dst
+}
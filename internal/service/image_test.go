@@ -0,0 +1,277 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+const exifMarker = "GPS 55.7558N 37.6173E"
+
+func testImage(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+// jpegWithExif кодирует картинку и вставляет сразу после SOI сегмент APP1
+// с EXIF, как это делают камеры
+func jpegWithExif(t *testing.T, img image.Image, payload []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+// jpegMarkers возвращает маркеры сегментов до начала сжатых данных
+func jpegMarkers(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		t.Fatal("not a jpeg")
+	}
+	var markers []byte
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			t.Fatalf("bad segment at %d", i)
+		}
+		marker := data[i+1]
+		markers = append(markers, marker)
+		if marker == 0xDA {
+			break
+		}
+		i += 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+	}
+	return markers
+}
+
+func TestProcessImageStripsExif(t *testing.T) {
+	payload := append([]byte("Exif\x00\x00II*\x00\x08\x00\x00\x00"), exifMarker...)
+	data := jpegWithExif(t, testImage(800, 600), payload)
+	if !bytes.Contains(data, []byte(exifMarker)) || !bytes.Contains(jpegMarkers(t, data), []byte{0xE1}) {
+		t.Fatal("test image has no exif segment")
+	}
+
+	processed, err := processImage(data, "image/jpeg")
+	if err != nil {
+		t.Fatalf("process: %v", err)
+	}
+
+	if bytes.Contains(jpegMarkers(t, processed.data), []byte{0xE1}) {
+		t.Error("APP1 segment survived processing")
+	}
+	if bytes.Contains(processed.data, []byte("Exif")) || bytes.Contains(processed.data, []byte(exifMarker)) {
+		t.Error("exif data survived processing")
+	}
+	if bytes.Contains(processed.thumbnail, []byte(exifMarker)) {
+		t.Error("exif data leaked into thumbnail")
+	}
+	if processed.width != 800 || processed.height != 600 {
+		t.Errorf("size = %dx%d, want 800x600", processed.width, processed.height)
+	}
+}
+
+// exifWithOrientation - EXIF в порядке байт Motorola с единственным тегом
+// Orientation в первом IFD
+func exifWithOrientation(orientation uint16) []byte {
+	payload := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08")
+	payload = binary.BigEndian.AppendUint16(payload, 1)
+	payload = binary.BigEndian.AppendUint16(payload, 0x0112)
+	payload = binary.BigEndian.AppendUint16(payload, 3)
+	payload = binary.BigEndian.AppendUint32(payload, 1)
+	payload = binary.BigEndian.AppendUint16(payload, orientation)
+	payload = append(payload, 0, 0)
+	return binary.BigEndian.AppendUint32(payload, 0)
+}
+
+// Телефон снимает портрет как альбомную картинку и пишет Orientation.
+// Левая половина снимка красная, правая синяя.
+func TestProcessImageAppliesOrientation(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 80, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 80; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= 40 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			src.Set(x, y, c)
+		}
+	}
+
+	tests := []struct {
+		orientation   uint16
+		width, height int
+		// Точки, которые должны оказаться красной и синей
+		red, blue image.Point
+	}{
+		{1, 80, 40, image.Pt(10, 20), image.Pt(70, 20)},
+		{3, 80, 40, image.Pt(70, 20), image.Pt(10, 20)},
+		{6, 40, 80, image.Pt(20, 10), image.Pt(20, 70)},
+		{8, 40, 80, image.Pt(20, 70), image.Pt(20, 10)},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.orientation), func(t *testing.T) {
+			data := jpegWithExif(t, src, exifWithOrientation(tt.orientation))
+			if got := exifOrientation(data); got != int(tt.orientation) {
+				t.Fatalf("exifOrientation = %d, want %d", got, tt.orientation)
+			}
+
+			processed, err := processImage(data, "image/jpeg")
+			if err != nil {
+				t.Fatalf("process: %v", err)
+			}
+			if processed.width != tt.width || processed.height != tt.height {
+				t.Errorf("size = %dx%d, want %dx%d", processed.width, processed.height, tt.width, tt.height)
+			}
+			if bytes.Contains(jpegMarkers(t, processed.data), []byte{0xE1}) {
+				t.Error("APP1 segment survived processing")
+			}
+
+			for name, data := range map[string][]byte{"image": processed.data, "thumbnail": processed.thumbnail} {
+				img, err := jpeg.Decode(bytes.NewReader(data))
+				if err != nil {
+					t.Fatalf("decode %s: %v", name, err)
+				}
+				if b := img.Bounds(); b.Dx() != tt.width || b.Dy() != tt.height {
+					t.Errorf("%s size = %dx%d, want %dx%d", name, b.Dx(), b.Dy(), tt.width, tt.height)
+				}
+				if r, _, b, _ := img.At(tt.red.X, tt.red.Y).RGBA(); r < 0xc000 || b > 0x4000 {
+					t.Errorf("%s at %v is not red", name, tt.red)
+				}
+				if r, _, b, _ := img.At(tt.blue.X, tt.blue.Y).RGBA(); b < 0xc000 || r > 0x4000 {
+					t.Errorf("%s at %v is not blue", name, tt.blue)
+				}
+			}
+		})
+	}
+}
+
+func TestExifOrientationIgnoresBrokenExif(t *testing.T) {
+	payload := append([]byte("Exif\x00\x00II*\x00\x08\x00\x00\x00"), exifMarker...)
+	if got := exifOrientation(jpegWithExif(t, testImage(8, 8), payload)); got != 1 {
+		t.Errorf("exifOrientation = %d, want 1", got)
+	}
+}
+
+func TestProcessImageThumbnail(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		wantW, wantH  int
+	}{
+		{"landscape", 800, 600, 320, 240},
+		{"portrait", 300, 1200, 80, 320},
+		{"small", 100, 50, 100, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, testImage(tt.width, tt.height)); err != nil {
+				t.Fatal(err)
+			}
+
+			processed, err := processImage(buf.Bytes(), "image/png")
+			if err != nil {
+				t.Fatalf("process: %v", err)
+			}
+
+			config, err := jpeg.DecodeConfig(bytes.NewReader(processed.thumbnail))
+			if err != nil {
+				t.Fatalf("thumbnail is not a jpeg: %v", err)
+			}
+			if max(config.Width, config.Height) > thumbnailSize {
+				t.Errorf("thumbnail %dx%d is larger than %d", config.Width, config.Height, thumbnailSize)
+			}
+			if config.Width != tt.wantW || config.Height != tt.wantH {
+				t.Errorf("thumbnail = %dx%d, want %dx%d", config.Width, config.Height, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestProcessImageRejectsHugeDimensions(t *testing.T) {
+	// Заголовок PNG с размерами 10000x10000 без данных: отклоняем до декодирования
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:], 10000)
+	binary.BigEndian.PutUint32(data[20:], 10000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	if _, err := processImage(data, "image/png"); err != errImageTooLarge {
+		t.Errorf("err = %v, want %v", err, errImageTooLarge)
+	}
+}
+
+// Маленький файл из множества сжатых кадров на весь холст: каждый кадр
+// по отдельности в пределах лимита, а вместе - нет
+func TestProcessImageRejectsGIFFrameBomb(t *testing.T) {
+	encode := func(frames, size int) []byte {
+		t.Helper()
+		palette := color.Palette{color.Black, color.White}
+		anim := &gif.GIF{}
+		for i := 0; i < frames; i++ {
+			anim.Image = append(anim.Image, image.NewPaletted(image.Rect(0, 0, size, size), palette))
+			anim.Delay = append(anim.Delay, 10)
+		}
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, anim); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	bomb := encode(11, 2000)
+	if pixels, err := gifFramePixels(bomb); err != nil || pixels <= maxImagePixels {
+		t.Fatalf("gifFramePixels = %d, %v", pixels, err)
+	}
+	if _, err := processImage(bomb, "image/gif"); err != errImageTooLarge {
+		t.Errorf("err = %v, want %v", err, errImageTooLarge)
+	}
+
+	small := encode(3, 100)
+	if pixels, err := gifFramePixels(small); err != nil || pixels != 3*100*100 {
+		t.Errorf("gifFramePixels = %d, %v, want %d", pixels, err, 3*100*100)
+	}
+	processed, err := processImage(small, "image/gif")
+	if err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	anim, err := gif.DecodeAll(bytes.NewReader(processed.data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(anim.Image) != 3 {
+		t.Errorf("frames = %d, want 3", len(anim.Image))
+	}
+
+	if _, err := gifFramePixels(small[:len(small)/2]); err != errBrokenGIF {
+		t.Errorf("truncated gif: err = %v, want %v", err, errBrokenGIF)
+	}
+}
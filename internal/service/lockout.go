@@ -0,0 +1,166 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"social-network/internal/models"
+	"social-network/internal/repository/postgres"
+	"time"
+)
+
+var (
+	ErrUnknownLockoutKind = errors.New("unknown lockout kind")
+)
+
+// Параметры защиты от подбора пароля. После порога каждая следующая
+// неудача удваивает время блокировки, но не дольше lockoutMax.
+const (
+	usernameFailureThreshold = 5
+	ipFailureThreshold       = 20
+	lockoutBase              = 30 * time.Second
+	lockoutMax               = time.Hour
+	// Через столько времени без неудач счетчик начинается заново
+	failureWindow = 15 * time.Minute
+	// Длина колонки login_attempts.key
+	maxLockoutKeyLength = 255
+)
+
+type LockoutService interface {
+	// Check возвращает, сколько еще ждать до следующей попытки входа
+	Check(username, ip string) (time.Duration, error)
+	RegisterFailure(username, ip string) error
+	RegisterSuccess(username string) error
+	Clear(adminID int, kind, key, ip string) error
+}
+
+type LockoutServiceImpl struct {
+	repo   *postgres.LockoutRepository
+	users  *postgres.UserRepository
+	events *postgres.SecurityEventRepository
+	policy *Policy
+}
+
+func NewLockoutService(repos *postgres.Repositories, policy *Policy) LockoutService {
+	return &LockoutServiceImpl{
+		repo:   repos.Lockouts,
+		users:  repos.Users,
+		events: repos.Events,
+		policy: policy,
+	}
+}
+
+func (s *LockoutServiceImpl) Check(username, ip string) (time.Duration, error) {
+	lockedUntil, locked, err := s.repo.GetLockedUntil(lockoutKey(username), lockoutKey(ip))
+	if err != nil || !locked {
+		return 0, err
+	}
+	return time.Until(lockedUntil), nil
+}
+
+// RegisterFailure считает неудачу и по IP, и по имени. Счетчики независимы:
+// ошибка одного не должна позволять перебирать пароли мимо другого.
+func (s *LockoutServiceImpl) RegisterFailure(username, ip string) error {
+	ipErr := s.registerFailure(models.LockoutKindIP, ip, ip, ipFailureThreshold)
+	usernameErr := s.registerFailure(models.LockoutKindUsername, username, ip, usernameFailureThreshold)
+	return errors.Join(ipErr, usernameErr)
+}
+
+// RegisterSuccess сбрасывает счетчик по имени. Счетчик по IP не трогаем:
+// иначе вход в свой аккаунт обнулял бы перебор чужих с того же адреса.
+func (s *LockoutServiceImpl) RegisterSuccess(username string) error {
+	err := s.repo.Reset(models.LockoutKindUsername, lockoutKey(username))
+	if err == postgres.ErrLockoutNotFound {
+		return nil
+	}
+	return err
+}
+
+func (s *LockoutServiceImpl) Clear(adminID int, kind, key, ip string) error {
+	if kind != models.LockoutKindUsername && kind != models.LockoutKindIP {
+		return ErrUnknownLockoutKind
+	}
+
+	admin, err := s.users.GetByID(adminID)
+	if err != nil {
+		return err
+	}
+	if err := s.policy.Authorize(admin, models.PermLockoutClear); err != nil {
+		if err == ErrPermissionDenied {
+			return ErrNotAdmin
+		}
+		return err
+	}
+
+	if err := s.repo.Reset(kind, lockoutKey(key)); err != nil {
+		return err
+	}
+
+	recordEvent(s.events, &models.SecurityEvent{
+		Type:    models.EventLockoutCleared,
+		UserID:  &adminID,
+		IP:      ip,
+		Details: fmt.Sprintf("%s=%s", kind, key),
+	})
+	return nil
+}
+
+func (s *LockoutServiceImpl) registerFailure(kind, key, ip string, threshold int) error {
+	key = lockoutKey(key)
+	failures, err := s.repo.RegisterFailure(kind, key, time.Now().Add(-failureWindow))
+	if err != nil {
+		return err
+	}
+	if failures < threshold {
+		return nil
+	}
+
+	duration := lockoutDuration(failures - threshold)
+	if err := s.repo.Lock(kind, key, time.Now().Add(duration)); err != nil {
+		return err
+	}
+
+	event := &models.SecurityEvent{
+		Type:    models.EventLoginLockout,
+		IP:      ip,
+		Details: fmt.Sprintf("%s=%s failures=%d duration=%s", kind, key, failures, duration),
+	}
+	if kind == models.LockoutKindUsername {
+		if user, err := s.users.GetByUsername(key); err == nil {
+			event.UserID = &user.ID
+		}
+	}
+	recordEvent(s.events, event)
+	return nil
+}
+
+// Журнал событий не должен ломать основное действие, поэтому ошибки только логируем
+func recordEvent(events *postgres.SecurityEventRepository, event *models.SecurityEvent) {
+	if err := events.Create(event); err != nil {
+		log.Printf("record security event %s: %v", event.Type, err)
+	}
+}
+
+// lockoutKey заменяет слишком длинный ключ его SHA-256. Имя пользователя
+// ничем не ограничено, и без этого вставка в login_attempts падала бы.
+// Настоящие имена не длиннее 50 символов, так что хэш с ними не совпадет.
+func lockoutKey(key string) string {
+	if len(key) <= maxLockoutKeyLength {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func lockoutDuration(excess int) time.Duration {
+	duration := lockoutBase
+	for i := 0; i < excess && duration < lockoutMax; i++ {
+		duration *= 2
+	}
+	if duration > lockoutMax {
+		duration = lockoutMax
+	}
+	return duration
+}
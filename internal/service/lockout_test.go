@@ -0,0 +1,42 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockoutKey(t *testing.T) {
+	if got := lockoutKey("alice"); got != "alice" {
+		t.Errorf("short key changed: %q", got)
+	}
+
+	long := strings.Repeat("a", 10000)
+	key := lockoutKey(long)
+	if len(key) > maxLockoutKeyLength {
+		t.Errorf("key length = %d, want at most %d", len(key), maxLockoutKeyLength)
+	}
+	if lockoutKey(long) != key {
+		t.Error("key is not stable")
+	}
+	if lockoutKey(long+"b") == key {
+		t.Error("different long names share a key")
+	}
+}
+
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		excess int
+		want   time.Duration
+	}{
+		{0, lockoutBase},
+		{1, 2 * lockoutBase},
+		{3, 8 * lockoutBase},
+		{100, lockoutMax},
+	}
+	for _, tt := range tests {
+		if got := lockoutDuration(tt.excess); got != tt.want {
+			t.Errorf("lockoutDuration(%d) = %v, want %v", tt.excess, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"social-network/internal/models"
+	"social-network/internal/repository/postgres"
+	"social-network/internal/security"
+	"social-network/internal/storage"
+	"time"
+)
+
+var (
+	ErrUnsupportedMedia = errors.New("unsupported media type")
+	ErrMediaTooLarge    = errors.New("media too large")
+)
+
+const (
+	MaxImageSize = 10 << 20
+	MaxVideoSize = 50 << 20
+
+	// Файлы, так и не прикрепленные к посту, удаляются через сутки
+	orphanMediaTTL      = 24 * time.Hour
+	orphanMediaInterval = time.Hour
+	orphanMediaBatch    = 100
+)
+
+// Разрешенные типы. Тип определяется по содержимому файла, заголовку
+// клиента не доверяем.
+var mediaTypes = map[string]struct {
+	kind    string
+	ext     string
+	maxSize int
+}{
+	"image/jpeg": {models.MediaKindImage, ".jpg", MaxImageSize},
+	"image/png":  {models.MediaKindImage, ".png", MaxImageSize},
+	"image/gif":  {models.MediaKindImage, ".gif", MaxImageSize},
+	"video/mp4":  {models.MediaKindVideo, ".mp4", MaxVideoSize},
+	"video/webm": {models.MediaKindVideo, ".webm", MaxVideoSize},
+}
+
+type MediaService interface {
+	Upload(userID int, data []byte) (*models.Media, error)
+	// Open возвращает файл или его превью, если читателю виден пост с
+	// вложением. viewerID == 0 - анонимный читатель.
+	Open(publicID string, viewerID int, thumbnail bool) (*MediaFile, error)
+}
+
+// MediaFile - содержимое вложения. Public означает, что файл виден всем
+// (вложение опубликованного публичного поста) и его можно кэшировать
+// в общих кэшах.
+type MediaFile struct {
+	Body        io.ReadCloser
+	ContentType string
+	Public      bool
+}
+
+type MediaServiceImpl struct {
+	repos  *postgres.Repositories
+	store  storage.BlobStore
+	policy *Policy
+}
+
+func NewMediaService(repos *postgres.Repositories, store storage.BlobStore, policy *Policy) MediaService {
+	return &MediaServiceImpl{repos: repos, store: store, policy: policy}
+}
+
+// Upload сохраняет файл, который потом прикрепляется к посту по id.
+// Картинки перекодируются без метаданных и получают превью. Видео
+// сохраняются как есть: перекодировать их без внешних инструментов
+// нельзя, поэтому метаданные контейнера остаются, а превью нет.
+func (s *MediaServiceImpl) Upload(userID int, data []byte) (*models.Media, error) {
+	user, err := s.repos.Users.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, postgres.ErrUserNotFound
+	}
+	if err := s.policy.Authorize(user, models.PermPostCreate); err != nil {
+		return nil, err
+	}
+
+	contentType := http.DetectContentType(data)
+	mediaType, ok := mediaTypes[contentType]
+	if !ok {
+		return nil, ErrUnsupportedMedia
+	}
+	if len(data) > mediaType.maxSize {
+		return nil, ErrMediaTooLarge
+	}
+
+	publicID := security.GenerateToken()[:32]
+	media := &models.Media{
+		PublicID:    publicID,
+		OwnerID:     &userID,
+		Kind:        mediaType.kind,
+		ContentType: contentType,
+		BlobKey:     "media/" + publicID + mediaType.ext,
+	}
+
+	var thumbnail []byte
+	if mediaType.kind == models.MediaKindImage {
+		img, err := processImage(data, contentType)
+		if err == errImageTooLarge {
+			return nil, ErrMediaTooLarge
+		}
+		if err != nil {
+			return nil, ErrUnsupportedMedia
+		}
+		data, thumbnail = img.data, img.thumbnail
+		media.Width, media.Height = &img.width, &img.height
+	}
+	media.Size = int64(len(data))
+
+	if err := s.store.Put(media.BlobKey, data, contentType); err != nil {
+		return nil, err
+	}
+	if thumbnail != nil {
+		thumbnailKey := "media/" + publicID + "_thumb.jpg"
+		if err := s.store.Put(thumbnailKey, thumbnail, "image/jpeg"); err != nil {
+			deleteMediaBlobs(s.store, media)
+			return nil, err
+		}
+		media.ThumbnailKey = &thumbnailKey
+	}
+
+	if err := s.repos.Media.Create(media); err != nil {
+		deleteMediaBlobs(s.store, media)
+		return nil, err
+	}
+
+	return media, nil
+}
+
+func (s *MediaServiceImpl) Open(publicID string, viewerID int, thumbnail bool) (*MediaFile, error) {
+	media, err := s.repos.Media.GetByPublicID(publicID)
+	if err != nil {
+		return nil, err
+	}
+
+	public, err := s.checkAccess(media, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, contentType := media.BlobKey, media.ContentType
+	if thumbnail {
+		if media.ThumbnailKey == nil {
+			return nil, postgres.ErrMediaNotFound
+		}
+		key, contentType = *media.ThumbnailKey, "image/jpeg"
+	}
+
+	body, err := s.store.Get(key)
+	if err == storage.ErrBlobNotFound {
+		return nil, postgres.ErrMediaNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &MediaFile{Body: body, ContentType: contentType, Public: public}, nil
+}
+
+// checkAccess пускает к вложению тех же читателей, что и к посту: права
+// проверяет PostRepository.GetByID. Еще не прикрепленный файл виден только
+// загрузившему. Недоступное вложение неотличимо от несуществующего.
+func (s *MediaServiceImpl) checkAccess(media *models.Media, viewerID int) (bool, error) {
+	if media.PostID == nil {
+		if viewerID == 0 || media.OwnerID == nil || *media.OwnerID != viewerID {
+			return false, postgres.ErrMediaNotFound
+		}
+		return false, nil
+	}
+
+	post, err := s.repos.Posts.GetByID(*media.PostID, viewerID)
+	if err == postgres.ErrPostNotFound {
+		return false, postgres.ErrMediaNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	return post.Status == models.PostStatusPublished && post.Visibility == models.PostVisibilityPublic, nil
+}
+
+func deleteMediaBlobs(store storage.BlobStore, media *models.Media) {
+	keys := []string{media.BlobKey}
+	if media.ThumbnailKey != nil {
+		keys = append(keys, *media.ThumbnailKey)
+	}
+	for _, key := range keys {
+		if err := store.Delete(key); err != nil && err != storage.ErrBlobNotFound {
+			log.Printf("media: delete %s: %v", key, err)
+		}
+	}
+}
+
+// MediaJanitor удаляет файлы, которые загрузили, но так и не прикрепили
+// к посту. Строки забираются с SKIP LOCKED, поэтому лидер не нужен.
+type MediaJanitor struct {
+	media *postgres.MediaRepository
+	store storage.BlobStore
+}
+
+func NewMediaJanitor(repos *postgres.Repositories, store storage.BlobStore) *MediaJanitor {
+	return &MediaJanitor{media: repos.Media, store: store}
+}
+
+func (j *MediaJanitor) Run() {
+	j.tick()
+
+	ticker := time.NewTicker(orphanMediaInterval)
+	for range ticker.C {
+		j.tick()
+	}
+}
+
+func (j *MediaJanitor) tick() {
+	for {
+		deleted, err := j.media.DeleteOrphans(time.Now().Add(-orphanMediaTTL), orphanMediaBatch)
+		if err != nil {
+			log.Printf("media janitor: %v", err)
+			return
+		}
+
+		for i := range deleted {
+			deleteMediaBlobs(j.store, &deleted[i])
+		}
+
+		if len(deleted) < orphanMediaBatch {
+			return
+		}
+	}
+}
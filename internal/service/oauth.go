@@ -0,0 +1,480 @@
+package service
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/url"
+	"social-network/internal/models"
+	"social-network/internal/repository/postgres"
+	"social-network/internal/security"
+	"strings"
+	"time"
+)
+
+// OAuthError - ошибка в терминах RFC 6749, код отдается клиенту как есть
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+var (
+	ErrInvalidClientName  = errors.New("client name must be between 1 and 100 characters")
+	ErrInvalidRedirectURI = errors.New("redirect uris must be absolute https, loopback http or app scheme urls without fragment")
+
+	ErrOAuthInvalidClient           = &OAuthError{"invalid_client", "client authentication failed"}
+	ErrOAuthRedirectMismatch        = &OAuthError{"invalid_request", "redirect_uri is not registered for this client"}
+	ErrOAuthUnsupportedResponseType = &OAuthError{"unsupported_response_type", "only response_type=code is supported"}
+	ErrOAuthPKCERequired            = &OAuthError{"invalid_request", "code_challenge with code_challenge_method=S256 is required"}
+	ErrOAuthInvalidScope            = &OAuthError{"invalid_scope", "scope is empty or unknown"}
+	ErrOAuthInvalidGrant            = &OAuthError{"invalid_grant", "authorization code or refresh token is invalid or expired"}
+	ErrOAuthUnsupportedGrantType    = &OAuthError{"unsupported_grant_type", "only authorization_code and refresh_token grants are supported"}
+)
+
+// Префиксы токенов приложений, по ним authMiddleware выбирает способ проверки
+const (
+	OAuthAccessTokenPrefix  = "oat_"
+	OAuthRefreshTokenPrefix = "ort_"
+)
+
+const (
+	authorizationCodeTTL = 10 * time.Minute
+	oauthAccessTokenTTL  = time.Hour
+	// Сессия приложения продлевается при каждом обновлении токенов
+	oauthSessionTTL       = 30 * 24 * time.Hour
+	maxClientRedirectURIs = 10
+)
+
+// AuthorizationRequest - параметры запроса /authorize
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// AuthorizationPrompt - что показать пользователю на экране согласия
+type AuthorizationPrompt struct {
+	Client *models.OAuthClient
+	Scopes []string
+	// Пользователь уже выдавал приложению все запрошенные права
+	Consented bool
+}
+
+// ClientCredentials - данные аутентификации клиента на token-эндпоинтах
+type ClientCredentials struct {
+	ClientID     string
+	ClientSecret string
+}
+
+type OAuthTokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int
+	Scopes       []string
+}
+
+// Introspection - ответ по RFC 7662
+type Introspection struct {
+	Active    bool
+	TokenType string
+	Scopes    []string
+	ClientID  string
+	UserID    int
+	Username  string
+	ExpiresAt time.Time
+}
+
+type OAuthService interface {
+	RegisterClient(ownerID int, name string, redirectURIs []string, confidential bool) (*models.OAuthClient, string, error)
+	GetUserClients(ownerID int) ([]models.OAuthClient, error)
+	DeleteClient(ownerID int, clientID string) error
+	PrepareAuthorization(userID int, req *AuthorizationRequest) (*AuthorizationPrompt, error)
+	Authorize(userID int, req *AuthorizationRequest, approved bool) (string, error)
+	ExchangeCode(creds ClientCredentials, code, redirectURI, verifier, ip string) (*OAuthTokenPair, error)
+	Refresh(creds ClientCredentials, refreshToken string) (*OAuthTokenPair, error)
+	Introspect(creds ClientCredentials, token string) (*Introspection, error)
+	Revoke(creds ClientCredentials, token string) error
+	Authenticate(accessToken string) (*models.OAuthToken, error)
+	GetUserConsents(userID int) ([]models.OAuthConsent, error)
+	RevokeConsent(userID int, clientID string) error
+}
+
+type OAuthServiceImpl struct {
+	repo  *postgres.OAuthRepository
+	users *postgres.UserRepository
+}
+
+func NewOAuthService(repos *postgres.Repositories) OAuthService {
+	return &OAuthServiceImpl{
+		repo:  repos.OAuth,
+		users: repos.Users,
+	}
+}
+
+// RegisterClient регистрирует приложение. Секрет конфиденциального
+// клиента возвращается только здесь.
+func (s *OAuthServiceImpl) RegisterClient(ownerID int, name string, redirectURIs []string, confidential bool) (*models.OAuthClient, string, error) {
+	name = strings.TrimSpace(name)
+	if len(name) < 1 || len(name) > 100 {
+		return nil, "", ErrInvalidClientName
+	}
+	if len(redirectURIs) == 0 || len(redirectURIs) > maxClientRedirectURIs {
+		return nil, "", ErrInvalidRedirectURI
+	}
+	for _, uri := range redirectURIs {
+		if !validRedirectURI(uri) {
+			return nil, "", ErrInvalidRedirectURI
+		}
+	}
+
+	client := &models.OAuthClient{
+		ClientID:     security.GenerateToken()[:32],
+		Name:         name,
+		OwnerID:      ownerID,
+		RedirectURIs: redirectURIs,
+	}
+
+	var secret string
+	if confidential {
+		secret = security.GenerateToken()
+		client.ClientSecretHash = security.HashToken(secret)
+	}
+
+	if err := s.repo.CreateClient(client); err != nil {
+		return nil, "", err
+	}
+
+	return client, secret, nil
+}
+
+func (s *OAuthServiceImpl) GetUserClients(ownerID int) ([]models.OAuthClient, error) {
+	return s.repo.GetUserClients(ownerID)
+}
+
+func (s *OAuthServiceImpl) DeleteClient(ownerID int, clientID string) error {
+	return s.repo.DeleteClient(ownerID, clientID)
+}
+
+func (s *OAuthServiceImpl) PrepareAuthorization(userID int, req *AuthorizationRequest) (*AuthorizationPrompt, error) {
+	client, scopes, err := s.validateAuthorization(req)
+	if err != nil {
+		return nil, err
+	}
+
+	granted, err := s.repo.GetConsentScopes(userID, client.ID)
+	if err != nil && err != postgres.ErrOAuthConsentNotFound {
+		return nil, err
+	}
+
+	return &AuthorizationPrompt{
+		Client:    client,
+		Scopes:    scopes,
+		Consented: containsAll(granted, scopes),
+	}, nil
+}
+
+// Authorize фиксирует решение пользователя и возвращает адрес,
+// на который нужно вернуть его в приложение
+func (s *OAuthServiceImpl) Authorize(userID int, req *AuthorizationRequest, approved bool) (string, error) {
+	client, scopes, err := s.validateAuthorization(req)
+	if err != nil {
+		return "", err
+	}
+
+	if !approved {
+		return redirectWithParams(req.RedirectURI, map[string]string{
+			"error": "access_denied",
+			"state": req.State,
+		})
+	}
+
+	if err := s.repo.SaveConsent(userID, client.ID, scopes); err != nil {
+		return "", err
+	}
+
+	code := security.GenerateToken()
+	err = s.repo.CreateCode(&models.OAuthAuthorizationCode{
+		CodeHash:      security.HashToken(code),
+		ClientID:      client.ID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(authorizationCodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return redirectWithParams(req.RedirectURI, map[string]string{
+		"code":  code,
+		"state": req.State,
+	})
+}
+
+func (s *OAuthServiceImpl) ExchangeCode(creds ClientCredentials, code, redirectURI, verifier, ip string) (*OAuthTokenPair, error) {
+	client, err := s.authenticateClient(creds)
+	if err != nil {
+		return nil, err
+	}
+
+	authCode, err := s.repo.UseCode(security.HashToken(code))
+	if err != nil {
+		if err == postgres.ErrAuthorizationCodeNotFound {
+			return nil, ErrOAuthInvalidGrant
+		}
+		return nil, err
+	}
+
+	if authCode.ClientID != client.ID || authCode.RedirectURI != redirectURI {
+		return nil, ErrOAuthInvalidGrant
+	}
+	if !security.VerifyPKCE(verifier, authCode.CodeChallenge) {
+		return nil, ErrOAuthInvalidGrant
+	}
+
+	pair, token := newOAuthTokenPair(authCode.Scopes)
+	token.ClientID = client.ID
+	token.UserID = authCode.UserID
+
+	session := &models.Session{
+		UserID:    authCode.UserID,
+		UserAgent: "OAuth: " + client.Name,
+		IP:        ip,
+		ExpiresAt: time.Now().Add(oauthSessionTTL),
+	}
+	if err := s.repo.CreateToken(session, token); err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+func (s *OAuthServiceImpl) Refresh(creds ClientCredentials, refreshToken string) (*OAuthTokenPair, error) {
+	client, err := s.authenticateClient(creds)
+	if err != nil {
+		return nil, err
+	}
+
+	pair, token := newOAuthTokenPair(nil)
+	token.RefreshExpiresAt = time.Now().Add(oauthSessionTTL)
+	if err := s.repo.RotateToken(client.ID, security.HashToken(refreshToken), token); err != nil {
+		if err == postgres.ErrOAuthTokenNotFound {
+			return nil, ErrOAuthInvalidGrant
+		}
+		return nil, err
+	}
+
+	pair.Scopes = token.Scopes
+	return pair, nil
+}
+
+// Introspect сообщает о токенах только их собственному клиенту,
+// для остальных токен выглядит неактивным
+func (s *OAuthServiceImpl) Introspect(creds ClientCredentials, token string) (*Introspection, error) {
+	client, err := s.authenticateClient(creds)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenHash := security.HashToken(token)
+	found, err := s.repo.FindToken(tokenHash)
+	if err == postgres.ErrOAuthTokenNotFound {
+		return &Introspection{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if found.ClientID != client.ID {
+		return &Introspection{}, nil
+	}
+
+	result := &Introspection{
+		Active:    true,
+		TokenType: "refresh_token",
+		Scopes:    found.Scopes,
+		ClientID:  client.ClientID,
+		UserID:    found.UserID,
+		ExpiresAt: found.RefreshExpiresAt,
+	}
+	if found.AccessTokenHash == tokenHash {
+		if time.Now().After(found.AccessExpiresAt) {
+			return &Introspection{}, nil
+		}
+		result.TokenType = "access_token"
+		result.ExpiresAt = found.AccessExpiresAt
+	}
+
+	user, err := s.users.GetByID(found.UserID)
+	if err != nil {
+		return nil, err
+	}
+	result.Username = user.Username
+
+	return result, nil
+}
+
+// Revoke по RFC 7009: неизвестный токен - не ошибка
+func (s *OAuthServiceImpl) Revoke(creds ClientCredentials, token string) error {
+	client, err := s.authenticateClient(creds)
+	if err != nil {
+		return err
+	}
+	return s.repo.RevokeToken(client.ID, security.HashToken(token))
+}
+
+func (s *OAuthServiceImpl) Authenticate(accessToken string) (*models.OAuthToken, error) {
+	return s.repo.UseAccessToken(security.HashToken(accessToken))
+}
+
+func (s *OAuthServiceImpl) GetUserConsents(userID int) ([]models.OAuthConsent, error) {
+	return s.repo.GetUserConsents(userID)
+}
+
+func (s *OAuthServiceImpl) RevokeConsent(userID int, clientID string) error {
+	return s.repo.DeleteConsent(userID, clientID)
+}
+
+// validateAuthorization проверяет запрос /authorize и возвращает клиента
+// и разобранный список прав. PKCE обязателен для всех клиентов.
+func (s *OAuthServiceImpl) validateAuthorization(req *AuthorizationRequest) (*models.OAuthClient, []string, error) {
+	client, err := s.repo.GetClient(req.ClientID)
+	if err != nil {
+		if err == postgres.ErrOAuthClientNotFound {
+			return nil, nil, ErrOAuthInvalidClient
+		}
+		return nil, nil, err
+	}
+
+	if !containsAll(client.RedirectURIs, []string{req.RedirectURI}) {
+		return nil, nil, ErrOAuthRedirectMismatch
+	}
+	if req.ResponseType != "code" {
+		return nil, nil, ErrOAuthUnsupportedResponseType
+	}
+	if req.CodeChallengeMethod != "S256" || !security.ValidPKCEVerifier(req.CodeChallenge) {
+		return nil, nil, ErrOAuthPKCERequired
+	}
+
+	scopes, err := parseScopes(req.Scope)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client, scopes, nil
+}
+
+func (s *OAuthServiceImpl) authenticateClient(creds ClientCredentials) (*models.OAuthClient, error) {
+	client, err := s.repo.GetClient(creds.ClientID)
+	if err != nil {
+		if err == postgres.ErrOAuthClientNotFound {
+			return nil, ErrOAuthInvalidClient
+		}
+		return nil, err
+	}
+
+	if !client.Confidential {
+		if creds.ClientSecret != "" {
+			return nil, ErrOAuthInvalidClient
+		}
+		return client, nil
+	}
+
+	secretHash := security.HashToken(creds.ClientSecret)
+	if subtle.ConstantTimeCompare([]byte(secretHash), []byte(client.ClientSecretHash)) != 1 {
+		return nil, ErrOAuthInvalidClient
+	}
+	return client, nil
+}
+
+func newOAuthTokenPair(scopes []string) (*OAuthTokenPair, *models.OAuthToken) {
+	pair := &OAuthTokenPair{
+		AccessToken:  OAuthAccessTokenPrefix + security.GenerateToken(),
+		RefreshToken: OAuthRefreshTokenPrefix + security.GenerateToken(),
+		ExpiresIn:    int(oauthAccessTokenTTL.Seconds()),
+		Scopes:       scopes,
+	}
+	token := &models.OAuthToken{
+		AccessTokenHash:  security.HashToken(pair.AccessToken),
+		RefreshTokenHash: security.HashToken(pair.RefreshToken),
+		Scopes:           scopes,
+		AccessExpiresAt:  time.Now().Add(oauthAccessTokenTTL),
+	}
+	return pair, token
+}
+
+// parseScopes разбирает scope из запроса: права через пробел, без повторов
+func parseScopes(scope string) ([]string, error) {
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !isValidScope(s) {
+			return nil, ErrOAuthInvalidScope
+		}
+		if !containsAll(scopes, []string{s}) {
+			scopes = append(scopes, s)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, ErrOAuthInvalidScope
+	}
+	return scopes, nil
+}
+
+func containsAll(set, items []string) bool {
+	for _, item := range items {
+		found := false
+		for _, s := range set {
+			if s == item {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// validRedirectURI допускает https, http только на loopback-адрес
+// и собственные схемы приложений вида com.example.app (RFC 8252)
+func validRedirectURI(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Fragment != "" {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	default:
+		return strings.Contains(u.Scheme, ".")
+	}
+}
+
+func redirectWithParams(redirectURI string, params map[string]string) (string, error) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	for key, value := range params {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"social-network/internal/models"
+	"social-network/internal/repository/postgres"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrPermissionDenied  = errors.New("permission denied")
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrAdminLockout      = errors.New("admin role must keep permission.manage")
+)
+
+// Матрица прав кэшируется в памяти. Изменения с этого экземпляра видны
+// сразу, с других - не позже чем через policyCacheTTL.
+const policyCacheTTL = time.Minute
+
+// Policy - единственное место, где решается, может ли пользователь
+// выполнить действие. Сервисы не проверяют роли сами.
+type Policy struct {
+	repo *postgres.PermissionRepository
+
+	mu         sync.RWMutex
+	loadedAt   time.Time
+	grants     map[models.UserRole]map[string]bool
+	privileged map[string]bool
+}
+
+func NewPolicy(repo *postgres.PermissionRepository) *Policy {
+	return &Policy{repo: repo}
+}
+
+// Authorize возвращает ErrPermissionDenied, если у роли нет права, и
+// ErrTwoFactorRequired, если право привилегированное, а 2FA не включена
+func (p *Policy) Authorize(user *models.User, permission string) error {
+	grants, privileged, err := p.load()
+	if err != nil {
+		return err
+	}
+
+	if !grants[user.Role][permission] {
+		return ErrPermissionDenied
+	}
+	if privileged[permission] && !user.TOTPEnabled {
+		return ErrTwoFactorRequired
+	}
+	return nil
+}
+
+// Invalidate сбрасывает кэш после изменения матрицы
+func (p *Policy) Invalidate() {
+	p.mu.Lock()
+	p.loadedAt = time.Time{}
+	p.mu.Unlock()
+}
+
+func (p *Policy) load() (map[models.UserRole]map[string]bool, map[string]bool, error) {
+	p.mu.RLock()
+	if time.Since(p.loadedAt) < policyCacheTTL {
+		grants, privileged := p.grants, p.privileged
+		p.mu.RUnlock()
+		return grants, privileged, nil
+	}
+	p.mu.RUnlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Since(p.loadedAt) < policyCacheTTL {
+		return p.grants, p.privileged, nil
+	}
+
+	permissions, err := p.repo.GetPermissions()
+	if err != nil {
+		return nil, nil, err
+	}
+	matrix, err := p.repo.GetRolePermissions()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privileged := make(map[string]bool, len(permissions))
+	for _, permission := range permissions {
+		privileged[permission.Name] = permission.Privileged
+	}
+
+	grants := make(map[models.UserRole]map[string]bool, len(matrix))
+	for role, names := range matrix {
+		grants[role] = make(map[string]bool, len(names))
+		for _, name := range names {
+			grants[role][name] = true
+		}
+	}
+
+	p.grants, p.privileged, p.loadedAt = grants, privileged, time.Now()
+	return grants, privileged, nil
+}
+
+type PermissionService interface {
+	GetMatrix(adminID int) ([]models.Permission, map[models.UserRole][]string, error)
+	SetRolePermissions(adminID int, role string, permissions []string, ip string) error
+}
+
+type PermissionServiceImpl struct {
+	repo   *postgres.PermissionRepository
+	users  *postgres.UserRepository
+	events *postgres.SecurityEventRepository
+	policy *Policy
+}
+
+func NewPermissionService(repos *postgres.Repositories, policy *Policy) PermissionService {
+	return &PermissionServiceImpl{
+		repo:   repos.Permissions,
+		users:  repos.Users,
+		events: repos.Events,
+		policy: policy,
+	}
+}
+
+// GetMatrix возвращает все права и матрицу "роль - право"
+func (s *PermissionServiceImpl) GetMatrix(adminID int) ([]models.Permission, map[models.UserRole][]string, error) {
+	if err := s.authorize(adminID); err != nil {
+		return nil, nil, err
+	}
+
+	permissions, err := s.repo.GetPermissions()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	matrix, err := s.repo.GetRolePermissions()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, role := range models.Roles {
+		if matrix[role] == nil {
+			matrix[role] = []string{}
+		}
+	}
+
+	return permissions, matrix, nil
+}
+
+func (s *PermissionServiceImpl) SetRolePermissions(adminID int, role string, permissions []string, ip string) error {
+	if err := s.authorize(adminID); err != nil {
+		return err
+	}
+
+	roleModel := getRole(role)
+	if roleModel == nil {
+		return ErrUnknownRole
+	}
+
+	known, err := s.repo.GetPermissions()
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, permission := range permissions {
+		if !hasPermission(known, permission) {
+			return ErrUnknownPermission
+		}
+		if !containsAll(names, []string{permission}) {
+			names = append(names, permission)
+		}
+	}
+
+	// Иначе администраторы потеряют возможность вернуть права
+	if *roleModel == models.RoleAdmin && !containsAll(names, []string{models.PermPermissionManage}) {
+		return ErrAdminLockout
+	}
+
+	if err := s.repo.SetRolePermissions(*roleModel, names); err != nil {
+		return err
+	}
+	s.policy.Invalidate()
+
+	recordEvent(s.events, &models.SecurityEvent{
+		Type:    models.EventPermissionsUpdated,
+		UserID:  &adminID,
+		IP:      ip,
+		Details: fmt.Sprintf("role=%s permissions=%s", role, strings.Join(names, ",")),
+	})
+	return nil
+}
+
+func (s *PermissionServiceImpl) authorize(adminID int) error {
+	admin, err := s.users.GetByID(adminID)
+	if err != nil {
+		return err
+	}
+	return s.policy.Authorize(admin, models.PermPermissionManage)
+}
+
+func hasPermission(permissions []models.Permission, name string) bool {
+	for _, permission := range permissions {
+		if permission.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"database/sql"
+	"social-network/internal/models"
+	"social-network/internal/repository/postgres"
+	"social-network/internal/testdb"
+	"testing"
+	"time"
+)
+
+type pollFixture struct {
+	db    *sql.DB
+	repos *postgres.Repositories
+	posts PostService
+	alice int
+	bob   int
+}
+
+func newPollFixture(t *testing.T) *pollFixture {
+	t.Helper()
+
+	db := testdb.Open(t)
+	repos := postgres.NewRepositories(db)
+	f := &pollFixture{db: db, repos: repos, posts: NewPostService(repos, NewPolicy(repos.Permissions))}
+
+	for _, user := range []struct {
+		name string
+		id   *int
+	}{{"alice", &f.alice}, {"bob", &f.bob}} {
+		u := &models.User{Username: user.name, PasswordHash: "-", Role: models.RoleUser}
+		if err := repos.Users.Create(u); err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+		*user.id = u.ID
+	}
+	return f
+}
+
+func testPoll(closesAt time.Time) *models.Poll {
+	return &models.Poll{
+		ClosesAt: closesAt,
+		Options:  []models.PollOption{{Text: "yes"}, {Text: "no"}},
+	}
+}
+
+// closePoll переносит закрытие опроса поста в прошлое
+func (f *pollFixture) closePoll(t *testing.T, postID int) {
+	t.Helper()
+	_, err := f.db.Exec(`UPDATE polls SET closes_at = CURRENT_TIMESTAMP - INTERVAL '1 second' WHERE post_id = $1`, postID)
+	if err != nil {
+		t.Fatalf("close poll: %v", err)
+	}
+}
+
+func TestPollVoteDeadline(t *testing.T) {
+	f := newPollFixture(t)
+
+	open, err := f.posts.Create(f.alice, "open poll", "", nil, testPoll(time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("create post: %v", err)
+	}
+	closed, err := f.posts.Create(f.alice, "closed poll", "", nil, testPoll(time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("create post: %v", err)
+	}
+	f.closePoll(t, closed.ID)
+
+	poll, err := f.posts.Vote(open.ID, f.bob, []int{open.Poll.Options[0].ID})
+	if err != nil {
+		t.Fatalf("vote: %v", err)
+	}
+	if poll.VoterCount == nil || *poll.VoterCount != 1 {
+		t.Errorf("voter count = %v, want 1", poll.VoterCount)
+	}
+	if _, err := f.posts.Vote(open.ID, f.bob, []int{open.Poll.Options[1].ID}); err != postgres.ErrAlreadyVoted {
+		t.Errorf("second vote: err = %v, want %v", err, postgres.ErrAlreadyVoted)
+	}
+
+	if _, err := f.posts.Vote(closed.ID, f.bob, []int{closed.Poll.Options[0].ID}); err != postgres.ErrPollClosed {
+		t.Errorf("vote in closed poll: err = %v, want %v", err, postgres.ErrPollClosed)
+	}
+	if err := f.repos.Polls.Vote(-1, f.bob, []int{1}); err != postgres.ErrPollNotFound {
+		t.Errorf("vote in missing poll: err = %v, want %v", err, postgres.ErrPollNotFound)
+	}
+}
+
+// Опрос не должен выйти в свет уже закрытым: ни при переносе публикации
+// за срок опроса, ни при публикации старого черновика
+func TestPollMustOutlivePublication(t *testing.T) {
+	f := newPollFixture(t)
+
+	publishAt := time.Now().Add(time.Hour)
+	scheduled, err := f.posts.CreateDraft(f.alice, "scheduled poll", "", nil, testPoll(publishAt.Add(time.Hour)), &publishAt)
+	if err != nil {
+		t.Fatalf("create draft: %v", err)
+	}
+
+	late := publishAt.Add(3 * time.Hour)
+	if err := f.posts.Schedule(scheduled.ID, f.alice, &late); err != ErrInvalidPoll {
+		t.Errorf("schedule after poll closes: err = %v, want %v", err, ErrInvalidPoll)
+	}
+	early := publishAt.Add(30 * time.Minute)
+	if err := f.posts.Schedule(scheduled.ID, f.alice, &early); err != nil {
+		t.Errorf("schedule before poll closes: %v", err)
+	}
+	if err := f.posts.Schedule(scheduled.ID, f.alice, nil); err != nil {
+		t.Errorf("back to drafts: %v", err)
+	}
+
+	draft, err := f.posts.CreateDraft(f.alice, "old draft", "", nil, testPoll(time.Now().Add(time.Hour)), nil)
+	if err != nil {
+		t.Fatalf("create draft: %v", err)
+	}
+	f.closePoll(t, draft.ID)
+	if err := f.posts.Publish(draft.ID, f.alice); err != ErrInvalidPoll {
+		t.Errorf("publish draft with closed poll: err = %v, want %v", err, ErrInvalidPoll)
+	}
+	if err := f.posts.Publish(scheduled.ID, f.alice); err != nil {
+		t.Errorf("publish draft with open poll: %v", err)
+	}
+}
@@ -2,52 +2,319 @@ package service
 
 import (
 	"errors"
+	"slices"
 	"social-network/internal/models"
 	"social-network/internal/repository/postgres"
 	"strings"
 	"time"
 	"unicode"
+	"unicode/utf8"
 )
 
 var (
-	ErrNotYourPost = errors.New("do not have access to post")
+	ErrNotYourPost        = errors.New("do not have access to post")
+	ErrInvalidPublishTime = errors.New("publish time must be in the future")
+	ErrTooManyAttachments = errors.New("too many attachments")
+	ErrInvalidPoll        = errors.New("invalid poll")
+	ErrInvalidVisibility  = errors.New("invalid visibility")
+	ErrReplyVisibility    = errors.New("reply cannot be more visible than its parent")
+	ErrPostNotPinnable    = errors.New("only public published posts can be pinned")
+)
+
+const (
+	MaxPostAttachments = 4
+
+	MinPollOptions      = 2
+	MaxPollOptions      = 4
+	MaxPollOptionLength = 100
 )
 
 type PostService interface {
-	Create(userID int, content string) (*models.Post, error)
-	GetByID(postID int) (*models.Post, error)
-	Update(postID, userID int, content string) error
+	Create(userID int, content, visibility string, mediaIDs []string, poll *models.Poll) (*models.Post, error)
+	CreateDraft(userID int, content, visibility string, mediaIDs []string, poll *models.Poll, publishAt *time.Time) (*models.Post, error)
+	Schedule(postID, userID int, publishAt *time.Time) error
+	Publish(postID, userID int) error
+	GetDrafts(userID int, page, perPage int) ([]models.Post, error)
+	CreateReply(parentID, userID int, content, visibility string) (*models.Post, error)
+	Quote(quotedID, userID int, content string) (*models.Post, error)
+	GetThread(postID, viewerID int, page, perPage int) (*models.Thread, error)
+	GetByID(postID, viewerID int) (*models.Post, error)
+	Update(postID, userID int, content string, expectedVersions []int) (*models.Post, error)
 	Delete(postID, userID int) error
-	GetUserPosts(userID int, page, perPage int, orderDesc bool, hashtag *string) ([]models.Post, error)
+	GetHistory(postID, viewerID int) ([]models.PostRevision, error)
+	RestoreRevision(postID, version, userID int) error
+	GetUserPosts(userID, viewerID int, page, perPage int, orderDesc bool, hashtag *string) ([]models.Post, error)
 	GetFeed(userID int, page, perPage int, orderDesc bool, hashtag *string) ([]models.Post, error)
-	GetPostsByHashtag(hashtag string, page, perPage int, orderDesc bool) ([]models.Post, error)
+	GetPostsByHashtag(hashtag string, viewerID int, page, perPage int, orderDesc bool) ([]models.Post, error)
 	GetMyPosts(userID int, page, perPage int, orderDesc bool) ([]models.Post, error)
+	GetMentions(userID int, page, perPage int, orderDesc bool) ([]models.Post, error)
+	Search(query string, viewerID int, page, perPage int) ([]models.Post, error)
+	Like(postID, userID int) error
+	Unlike(postID, userID int) error
+	GetLikers(postID, viewerID int, page, perPage int) ([]models.User, error)
+	GetLikedPosts(userID, viewerID int, page, perPage int) ([]models.Post, error)
+	Repost(postID, userID int) error
+	Unrepost(postID, userID int) error
+	Vote(postID, userID int, optionIDs []int) (*models.Poll, error)
+	SetVisibility(postID, userID int, visibility string) error
+	Pin(postID, userID int) error
+	Unpin(postID, userID int) error
 }
 
 type PostServiceImpl struct {
-	repos *postgres.Repositories
+	repos  *postgres.Repositories
+	policy *Policy
 }
 
-func NewPostService(repos *postgres.Repositories) PostService {
-	return &PostServiceImpl{repos: repos}
+func NewPostService(repos *postgres.Repositories, policy *Policy) PostService {
+	return &PostServiceImpl{repos: repos, policy: policy}
 }
 
-func (s *PostServiceImpl) Create(userID int, content string) (*models.Post, error) {
-	user, err := s.repos.Users.GetByID(userID)
+// Create публикует пост. visibility - кому виден пост (пустая строка -
+// всем), mediaIDs - id загруженных автором файлов в порядке показа,
+// poll - необязательный опрос (нужны только варианты, срок и тип)
+func (s *PostServiceImpl) Create(userID int, content, visibility string, mediaIDs []string, poll *models.Poll) (*models.Post, error) {
+	post := newPost(userID, content, models.PostStatusPublished)
+	if err := withVisibility(post, visibility); err != nil {
+		return nil, err
+	}
+	if err := withMedia(post, mediaIDs); err != nil {
+		return nil, err
+	}
+	if err := withPoll(post, poll, time.Now()); err != nil {
+		return nil, err
+	}
+	return s.create(post, nil, nil)
+}
+
+// CreateDraft сохраняет черновик или, если задан publishAt, запланированный пост
+func (s *PostServiceImpl) CreateDraft(userID int, content, visibility string, mediaIDs []string, poll *models.Poll, publishAt *time.Time) (*models.Post, error) {
+	post := newPost(userID, content, models.PostStatusDraft)
+	if err := withVisibility(post, visibility); err != nil {
+		return nil, err
+	}
+	if err := withMedia(post, mediaIDs); err != nil {
+		return nil, err
+	}
+	// Опрос запланированного поста должен пережить публикацию
+	opensAt := time.Now()
+	if publishAt != nil {
+		if !publishAt.After(opensAt) {
+			return nil, ErrInvalidPublishTime
+		}
+		if err := s.authorizeUser(userID, models.PermPostPublish); err != nil {
+			return nil, err
+		}
+		post.Status = models.PostStatusScheduled
+		post.PublishAt = publishAt
+		opensAt = *publishAt
+	}
+	if err := withPoll(post, poll, opensAt); err != nil {
+		return nil, err
+	}
+	return s.create(post, nil, nil)
+}
+
+// Schedule переносит публикацию неопубликованного поста. publishAt == nil
+// возвращает пост в черновики.
+func (s *PostServiceImpl) Schedule(postID, userID int, publishAt *time.Time) error {
+	if err := s.authorizeUser(userID, models.PermPostPublish); err != nil {
+		return err
+	}
+	post, err := s.getOwnPost(postID, userID)
+	if err != nil {
+		return err
+	}
+	if publishAt != nil && !publishAt.After(time.Now()) {
+		return ErrInvalidPublishTime
+	}
+	// Опрос не должен выйти в свет уже закрытым
+	if publishAt != nil && post.Poll != nil && !post.Poll.ClosesAt.After(*publishAt) {
+		return ErrInvalidPoll
+	}
+	return s.repos.Posts.Schedule(post.ID, publishAt)
+}
+
+// Publish публикует черновик или запланированный пост сразу
+func (s *PostServiceImpl) Publish(postID, userID int) error {
+	if err := s.authorizeUser(userID, models.PermPostPublish); err != nil {
+		return err
+	}
+	post, err := s.getOwnPost(postID, userID)
+	if err != nil {
+		return err
+	}
+	if post.Poll != nil && !post.Poll.ClosesAt.After(time.Now()) {
+		return ErrInvalidPoll
+	}
+	return publishPost(s.repos.Posts, post)
+}
+
+func (s *PostServiceImpl) GetDrafts(userID int, page, perPage int) ([]models.Post, error) {
+	return s.repos.Posts.GetDrafts(userID, page, perPage)
+}
+
+// CreateReply отвечает на пост. Ответ наследует ветку родителя и его
+// видимость: ответ часто пересказывает родителя, поэтому visibility может
+// только сузить аудиторию, но не расширить.
+func (s *PostServiceImpl) CreateReply(parentID, userID int, content, visibility string) (*models.Post, error) {
+	parent, err := s.getPublished(parentID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	post := newPost(userID, content, models.PostStatusPublished)
+	post.Visibility = parent.Visibility
+	if visibility != "" {
+		if !isValidVisibility(visibility) {
+			return nil, ErrInvalidVisibility
+		}
+		if slices.Index(models.PostVisibilities, visibility) < slices.Index(models.PostVisibilities, parent.Visibility) {
+			return nil, ErrReplyVisibility
+		}
+		post.Visibility = visibility
+	}
+	return s.create(post, parent, nil)
+}
+
+// Quote создает пост, цитирующий другой пост
+func (s *PostServiceImpl) Quote(quotedID, userID int, content string) (*models.Post, error) {
+	quoted, err := s.getPublished(quotedID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.create(newPost(userID, content, models.PostStatusPublished), nil, quoted)
+}
+
+// GetThread возвращает пост, его предков до корня ветки и страницу ответов.
+// Ответы собраны в дерево, но страница режет обход в глубину, поэтому ответ,
+// чей родитель остался на прошлой странице, оказывается на верхнем уровне.
+func (s *PostServiceImpl) GetThread(postID, viewerID int, page, perPage int) (*models.Thread, error) {
+	post, err := s.repos.Posts.GetByID(postID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	ancestors, err := s.repos.Posts.GetThreadAncestors(postID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := s.repos.Posts.GetThreadReplies(postID, viewerID, page, perPage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Thread{
+		Post:      post,
+		Ancestors: nonNilPosts(ancestors),
+		Replies:   buildReplyTree(replies),
+	}, nil
+}
+
+func newPost(userID int, content, status string) *models.Post {
+	return &models.Post{
+		AuthorID:   userID,
+		Content:    content,
+		Hashtags:   extractHashtags(content),
+		Mentions:   extractMentions(content),
+		Status:     status,
+		Visibility: models.PostVisibilityPublic,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+}
+
+func withVisibility(post *models.Post, visibility string) error {
+	if visibility == "" {
+		return nil
+	}
+	if !isValidVisibility(visibility) {
+		return ErrInvalidVisibility
+	}
+	post.Visibility = visibility
+	return nil
+}
+
+func isValidVisibility(visibility string) bool {
+	for _, v := range models.PostVisibilities {
+		if v == visibility {
+			return true
+		}
+	}
+	return false
+}
+
+// withMedia задает вложения поста. Репозиторий прикрепит их при создании
+// и вернет postgres.ErrMediaNotFound, если файл чужой или уже занят.
+func withMedia(post *models.Post, mediaIDs []string) error {
+	if len(mediaIDs) > MaxPostAttachments {
+		return ErrTooManyAttachments
+	}
+	seen := make(map[string]bool, len(mediaIDs))
+	for _, id := range mediaIDs {
+		if seen[id] {
+			return postgres.ErrMediaNotFound
+		}
+		seen[id] = true
+		post.Media = append(post.Media, models.Media{PublicID: id})
+	}
+	return nil
+}
+
+// withPoll проверяет и задает опрос поста. Опрос должен закрываться
+// позже opensAt.
+func withPoll(post *models.Post, poll *models.Poll, opensAt time.Time) error {
+	if poll == nil {
+		return nil
+	}
+	if len(poll.Options) < MinPollOptions || len(poll.Options) > MaxPollOptions {
+		return ErrInvalidPoll
+	}
+	if !poll.ClosesAt.After(opensAt) {
+		return ErrInvalidPoll
+	}
+
+	options := make([]models.PollOption, len(poll.Options))
+	for i, option := range poll.Options {
+		text := strings.TrimSpace(option.Text)
+		if text == "" || utf8.RuneCountInString(text) > MaxPollOptionLength {
+			return ErrInvalidPoll
+		}
+		options[i] = models.PollOption{Text: text}
+	}
+
+	post.Poll = &models.Poll{
+		MultipleChoice: poll.MultipleChoice,
+		ClosesAt:       poll.ClosesAt,
+		Options:        options,
+	}
+	return nil
+}
+
+func (s *PostServiceImpl) create(post *models.Post, parent, quoted *models.Post) (*models.Post, error) {
+	user, err := s.repos.Users.GetByID(post.AuthorID)
 	if err != nil {
 		return nil, err
 	}
 	if user == nil {
 		return nil, postgres.ErrUserNotFound
 	}
-	// Create post object
-	post := &models.Post{
-		AuthorID:  userID,
-		Author:    user,
-		Content:   content,
-		Hashtags:  extractHashtags(content),
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	if err := s.policy.Authorize(user, models.PermPostCreate); err != nil {
+		return nil, err
+	}
+	post.Author = user
+	if parent != nil {
+		rootID := parent.ID
+		if parent.RootID != nil {
+			rootID = *parent.RootID
+		}
+		post.ParentID = &parent.ID
+		post.RootID = &rootID
+		post.ReplyToUserID = &parent.AuthorID
+	}
+	if quoted != nil {
+		post.QuoteOfID = &quoted.ID
 	}
 
 	// Save to repository
@@ -58,38 +325,145 @@ func (s *PostServiceImpl) Create(userID int, content string) (*models.Post, erro
 	return post, nil
 }
 
-func (s *PostServiceImpl) GetByID(postID int) (*models.Post, error) {
-	return s.repos.Posts.GetByID(postID)
+func (s *PostServiceImpl) GetByID(postID, viewerID int) (*models.Post, error) {
+	return s.repos.Posts.GetByID(postID, viewerID)
 }
 
-func (s *PostServiceImpl) Update(postID, userID int, content string) error {
+// getPublished - пост, на который можно ответить, лайкнуть и т.п.
+// Собственные черновики читателя для этого не годятся.
+func (s *PostServiceImpl) getPublished(postID, viewerID int) (*models.Post, error) {
+	post, err := s.repos.Posts.GetByID(postID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	if post.Status != models.PostStatusPublished {
+		return nil, postgres.ErrPostNotFound
+	}
+	return post, nil
+}
+
+// getOwnPost - неопубликованный пост, которым распоряжается только автор
+func (s *PostServiceImpl) getOwnPost(postID, userID int) (*models.Post, error) {
+	post, err := s.repos.Posts.GetByID(postID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if post.AuthorID != userID {
+		return nil, ErrNotYourPost
+	}
+	if post.Status == models.PostStatusPublished {
+		return nil, postgres.ErrPostPublished
+	}
+	return post, nil
+}
+
+// Update меняет текст поста. expectedVersions - версии, которые видел
+// редактор; если текущей среди них нет, возвращается postgres.ErrVersionMismatch.
+func (s *PostServiceImpl) Update(postID, userID int, content string, expectedVersions []int) (*models.Post, error) {
 	// Get post
-	post, err := s.repos.Posts.GetByID(postID)
+	post, err := s.repos.Posts.GetForModeration(postID, userID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Get user with role using existing method
 	user, err := s.repos.Users.GetByID(userID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if !(post.AuthorID == userID ||
-		user.Role == models.RoleAdmin ||
-		user.Role == models.RoleModerator) {
-		return ErrNotYourPost
+	permission := models.PermPostEditAny
+	if post.AuthorID == userID {
+		permission = models.PermPostEditOwn
+	}
+	if err := s.policy.Authorize(user, permission); err != nil {
+		if err == ErrPermissionDenied {
+			return nil, ErrNotYourPost
+		}
+		return nil, err
 	}
 
 	post.Content = content
 	post.Hashtags = extractHashtags(content)
+	post.Mentions = extractMentions(content)
+	post.LastEditorID = &userID
+	post.UpdatedAt = time.Now()
+	if err := s.repos.Posts.Update(post, expectedVersions); err != nil {
+		return nil, err
+	}
+
+	return post, nil
+}
+
+// GetHistory возвращает все версии поста, новые первыми. У каждой версии,
+// кроме первой, есть пословные отличия от предыдущей.
+func (s *PostServiceImpl) GetHistory(postID, viewerID int) ([]models.PostRevision, error) {
+	if err := s.authorizeUser(viewerID, models.PermPostHistoryRead); err != nil {
+		return nil, err
+	}
+	post, err := s.repos.Posts.GetByID(postID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, err := s.repos.Posts.GetRevisions(postID)
+	if err != nil {
+		return nil, err
+	}
+
+	current := models.PostRevision{
+		Version:   post.EditCount + 1,
+		Content:   post.Content,
+		EditorID:  post.LastEditorID,
+		Current:   true,
+		CreatedAt: post.UpdatedAt,
+	}
+	if post.LastEditorID != nil {
+		if editor, err := s.repos.Users.GetByID(*post.LastEditorID); err == nil && editor != nil {
+			current.Editor = &editor.Username
+		}
+	}
+	revisions = append(revisions, current)
+
+	for i := 1; i < len(revisions); i++ {
+		revisions[i].Changes = diffWords(revisions[i-1].Content, revisions[i].Content)
+	}
+
+	history := make([]models.PostRevision, 0, len(revisions))
+	for i := len(revisions) - 1; i >= 0; i-- {
+		history = append(history, revisions[i])
+	}
+	return history, nil
+}
+
+// RestoreRevision возвращает посту текст старой версии. Восстановление -
+// обычная правка, поэтому оно тоже попадает в историю.
+func (s *PostServiceImpl) RestoreRevision(postID, version, userID int) error {
+	if err := s.authorizeUser(userID, models.PermPostRevisionRestore); err != nil {
+		return err
+	}
+
+	post, err := s.repos.Posts.GetForModeration(postID, userID)
+	if err != nil {
+		return err
+	}
+
+	revision, err := s.repos.Posts.GetRevision(postID, version)
+	if err != nil {
+		return err
+	}
+
+	post.Content = revision.Content
+	post.Hashtags = extractHashtags(revision.Content)
+	post.Mentions = extractMentions(revision.Content)
+	post.LastEditorID = &userID
 	post.UpdatedAt = time.Now()
-	return s.repos.Posts.Update(post)
+	return s.repos.Posts.Update(post, nil)
 }
 
 func (s *PostServiceImpl) Delete(postID, userID int) error {
 	// Get post
-	post, err := s.repos.Posts.GetByID(postID)
+	post, err := s.repos.Posts.GetForModeration(postID, userID)
 	if err != nil {
 		return err
 	}
@@ -100,29 +474,225 @@ func (s *PostServiceImpl) Delete(postID, userID int) error {
 		return err
 	}
 
-	// Check if user is owner or admin
-	if !(post.AuthorID == userID ||
-		user.Role == models.RoleAdmin) {
-		return ErrNotYourPost
+	permission := models.PermPostDeleteAny
+	if post.AuthorID == userID {
+		permission = models.PermPostDeleteOwn
+	}
+	if err := s.policy.Authorize(user, permission); err != nil {
+		if err == ErrPermissionDenied {
+			return ErrNotYourPost
+		}
+		return err
 	}
 
 	return s.repos.Posts.Delete(postID)
 }
 
-func (s *PostServiceImpl) GetUserPosts(userID int, page, perPage int, orderDesc bool, hashtag *string) ([]models.Post, error) {
-	return s.repos.Posts.GetUserPosts(userID, page, perPage, orderDesc, hashtag)
+func (s *PostServiceImpl) GetUserPosts(userID, viewerID int, page, perPage int, orderDesc bool, hashtag *string) ([]models.Post, error) {
+	return s.repos.Posts.GetUserPosts(userID, viewerID, page, perPage, orderDesc, hashtag)
 }
 
 func (s *PostServiceImpl) GetFeed(userID int, page, perPage int, orderDesc bool, hashtag *string) ([]models.Post, error) {
 	return s.repos.Posts.GetFeedPosts(userID, page, perPage, orderDesc, hashtag)
 }
 
-func (s *PostServiceImpl) GetPostsByHashtag(hashtag string, page, perPage int, orderDesc bool) ([]models.Post, error) {
-	return s.repos.Posts.GetPostsByHashtag(hashtag, models.SearchTypeAll, "", page, perPage, orderDesc)
+func (s *PostServiceImpl) GetPostsByHashtag(hashtag string, viewerID int, page, perPage int, orderDesc bool) ([]models.Post, error) {
+	return s.repos.Posts.GetPostsByHashtag(hashtag, models.SearchTypeAll, "", viewerID, page, perPage, orderDesc)
 }
 
 func (s *PostServiceImpl) GetMyPosts(userID int, page, perPage int, orderDesc bool) ([]models.Post, error) {
-	return s.GetUserPosts(userID, page, perPage, orderDesc, nil)
+	return s.GetUserPosts(userID, userID, page, perPage, orderDesc, nil)
+}
+
+func (s *PostServiceImpl) GetMentions(userID int, page, perPage int, orderDesc bool) ([]models.Post, error) {
+	return s.repos.Posts.GetMentions(userID, page, perPage, orderDesc)
+}
+
+// Like ставит лайк. Повторный лайк ничего не меняет.
+func (s *PostServiceImpl) Like(postID, userID int) error {
+	if err := s.authorizeUser(userID, models.PermPostLike); err != nil {
+		return err
+	}
+	if _, err := s.getPublished(postID, userID); err != nil {
+		return err
+	}
+	return s.repos.Posts.Like(postID, userID)
+}
+
+func (s *PostServiceImpl) Unlike(postID, userID int) error {
+	if err := s.authorizeUser(userID, models.PermPostLike); err != nil {
+		return err
+	}
+	return s.repos.Posts.Unlike(postID, userID)
+}
+
+func (s *PostServiceImpl) GetLikers(postID, viewerID int, page, perPage int) ([]models.User, error) {
+	if _, err := s.getPublished(postID, viewerID); err != nil {
+		return nil, err
+	}
+	return s.repos.Users.GetPostLikers(postID, page, perPage)
+}
+
+func (s *PostServiceImpl) GetLikedPosts(userID, viewerID int, page, perPage int) ([]models.Post, error) {
+	return s.repos.Posts.GetLikedPosts(userID, viewerID, page, perPage)
+}
+
+// Repost продвигает пост в ленты подписчиков. Повторный репост ничего не меняет.
+func (s *PostServiceImpl) Repost(postID, userID int) error {
+	if err := s.authorizeUser(userID, models.PermPostRepost); err != nil {
+		return err
+	}
+	if _, err := s.getPublished(postID, userID); err != nil {
+		return err
+	}
+	return s.repos.Posts.Repost(postID, userID)
+}
+
+func (s *PostServiceImpl) Unrepost(postID, userID int) error {
+	if err := s.authorizeUser(userID, models.PermPostRepost); err != nil {
+		return err
+	}
+	return s.repos.Posts.Unrepost(postID, userID)
+}
+
+// Vote голосует в опросе поста и возвращает опрос уже с результатами.
+// Без множественного выбора можно выбрать только один вариант.
+func (s *PostServiceImpl) Vote(postID, userID int, optionIDs []int) (*models.Poll, error) {
+	if err := s.authorizeUser(userID, models.PermPollVote); err != nil {
+		return nil, err
+	}
+	post, err := s.getPublished(postID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if post.Poll == nil {
+		return nil, postgres.ErrPollNotFound
+	}
+
+	seen := make(map[int]bool, len(optionIDs))
+	for _, id := range optionIDs {
+		if seen[id] {
+			return nil, postgres.ErrInvalidPollOption
+		}
+		seen[id] = true
+	}
+	if len(optionIDs) == 0 || (!post.Poll.MultipleChoice && len(optionIDs) > 1) {
+		return nil, postgres.ErrInvalidPollOption
+	}
+
+	if err := s.repos.Polls.Vote(post.Poll.ID, userID, optionIDs); err != nil {
+		return nil, err
+	}
+
+	post, err = s.repos.Posts.GetByID(postID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return post.Poll, nil
+}
+
+// SetVisibility меняет видимость поста. Закрепление непубличного поста
+// при этом снимается.
+func (s *PostServiceImpl) SetVisibility(postID, userID int, visibility string) error {
+	if !isValidVisibility(visibility) {
+		return ErrInvalidVisibility
+	}
+	if err := s.authorizeUser(userID, models.PermPostVisibility); err != nil {
+		return err
+	}
+	if _, err := s.getAuthoredPost(postID, userID); err != nil {
+		return err
+	}
+	return s.repos.Posts.SetVisibility(postID, visibility)
+}
+
+// Pin закрепляет пост в профиле автора
+func (s *PostServiceImpl) Pin(postID, userID int) error {
+	if err := s.authorizeUser(userID, models.PermPostPin); err != nil {
+		return err
+	}
+	post, err := s.getAuthoredPost(postID, userID)
+	if err != nil {
+		return err
+	}
+	if post.Status != models.PostStatusPublished || post.Visibility != models.PostVisibilityPublic {
+		return ErrPostNotPinnable
+	}
+	return s.repos.Posts.Pin(postID, userID)
+}
+
+func (s *PostServiceImpl) Unpin(postID, userID int) error {
+	if err := s.authorizeUser(userID, models.PermPostPin); err != nil {
+		return err
+	}
+	if _, err := s.getAuthoredPost(postID, userID); err != nil {
+		return err
+	}
+	return s.repos.Posts.Unpin(postID)
+}
+
+// getAuthoredPost - пост, которым распоряжается только автор, в любом статусе
+func (s *PostServiceImpl) getAuthoredPost(postID, userID int) (*models.Post, error) {
+	post, err := s.repos.Posts.GetByID(postID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if post.AuthorID != userID {
+		return nil, ErrNotYourPost
+	}
+	return post, nil
+}
+
+func (s *PostServiceImpl) authorizeUser(userID int, permission string) error {
+	user, err := s.repos.Users.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return postgres.ErrUserNotFound
+	}
+	return s.policy.Authorize(user, permission)
+}
+
+// buildReplyTree раскладывает ответы, идущие в порядке обхода в глубину,
+// по спискам Replies их родителей
+func buildReplyTree(posts []models.Post) []models.Post {
+	onPage := make(map[int]bool, len(posts))
+	for _, post := range posts {
+		onPage[post.ID] = true
+	}
+
+	children := make(map[int][]int)
+	var top []int
+	for i, post := range posts {
+		if post.ParentID != nil && onPage[*post.ParentID] {
+			children[*post.ParentID] = append(children[*post.ParentID], i)
+		} else {
+			top = append(top, i)
+		}
+	}
+
+	var build func(i int) models.Post
+	build = func(i int) models.Post {
+		post := posts[i]
+		for _, child := range children[post.ID] {
+			post.Replies = append(post.Replies, build(child))
+		}
+		return post
+	}
+
+	tree := make([]models.Post, 0, len(top))
+	for _, i := range top {
+		tree = append(tree, build(i))
+	}
+	return tree
+}
+
+func nonNilPosts(posts []models.Post) []models.Post {
+	if posts == nil {
+		return []models.Post{}
+	}
+	return posts
 }
 
 func extractHashtags(content string) []string {
@@ -149,6 +719,41 @@ func extractHashtags(content string) []string {
 	return hashtags
 }
 
+// extractMentions находит @username в тексте. Существование пользователей
+// не проверяется: несуществующие имена отсеет репозиторий
+func extractMentions(content string) []string {
+	words := strings.Fields(content)
+
+	mentionMap := make(map[string]struct{})
+
+	for _, word := range words {
+		if strings.HasPrefix(word, "@") {
+			username := strings.TrimLeft(word, "@")
+			username = strings.TrimRight(username, ".,!?:;")
+
+			if len(username) > 0 && isValidMention(username) {
+				mentionMap[username] = struct{}{}
+			}
+		}
+	}
+
+	mentions := make([]string, 0, len(mentionMap))
+	for username := range mentionMap {
+		mentions = append(mentions, username)
+	}
+
+	return mentions
+}
+
+func isValidMention(username string) bool {
+	for _, r := range username {
+		if r == '@' || r == '#' {
+			return false
+		}
+	}
+	return true
+}
+
 func isValidHashtag(hashtag string) bool {
 	for _, r := range hashtag {
 		if !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '_' {
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"log"
+	"social-network/internal/models"
+	"social-network/internal/repository/postgres"
+	"time"
+)
+
+const (
+	// Ключ advisory-блокировки, которой выбирается лидер publisher
+	publisherLockKey int64 = 17001
+	publishBatchSize       = 100
+)
+
+// Publisher публикует запланированные посты. Его запускают все экземпляры
+// сервиса, но работает только лидер - владелец advisory-блокировки.
+type Publisher struct {
+	posts    *postgres.PostRepository
+	leader   *postgres.LeaderLock
+	interval time.Duration
+}
+
+func NewPublisher(repos *postgres.Repositories, interval time.Duration) *Publisher {
+	return &Publisher{
+		posts:    repos.Posts,
+		leader:   repos.Locks.Leader(publisherLockKey),
+		interval: interval,
+	}
+}
+
+// Run проверяет расписание каждые interval, пока работает процесс
+func (p *Publisher) Run() {
+	p.tick()
+
+	ticker := time.NewTicker(p.interval)
+	for range ticker.C {
+		p.tick()
+	}
+}
+
+func (p *Publisher) tick() {
+	leader, err := p.leader.Acquire()
+	if err != nil {
+		log.Printf("publisher: %v", err)
+		return
+	}
+	if !leader {
+		return
+	}
+
+	// Ошибка одного поста не должна задерживать остальные: пропускаем его
+	// и идем дальше по курсору, а повторим на следующем тике
+	var (
+		afterPublishAt time.Time
+		afterID        int
+	)
+	for {
+		posts, err := p.posts.GetDuePosts(afterPublishAt, afterID, publishBatchSize)
+		if err != nil {
+			log.Printf("publisher: %v", err)
+			return
+		}
+
+		for i := range posts {
+			err := publishPost(p.posts, &posts[i])
+			if err != nil && err != postgres.ErrPostPublished {
+				log.Printf("publisher: post %d: %v", posts[i].ID, err)
+			}
+		}
+
+		if len(posts) < publishBatchSize {
+			return
+		}
+		last := posts[len(posts)-1]
+		afterPublishAt, afterID = *last.PublishAt, last.ID
+	}
+}
+
+// publishPost публикует пост. Хэштеги и упоминания берутся из текста на
+// момент публикации: черновик могли править после создания.
+func publishPost(posts *postgres.PostRepository, post *models.Post) error {
+	post.Hashtags = extractHashtags(post.Content)
+	post.Mentions = extractMentions(post.Content)
+	return posts.Publish(post)
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"fmt"
+	"social-network/internal/models"
+	"social-network/internal/repository/postgres"
+	"social-network/internal/testdb"
+	"testing"
+	"time"
+)
+
+// Пост, который не удается опубликовать, не должен задерживать остальные
+// и зацикливать publisher, даже если такими постами занята целая пачка
+func TestPublisherSkipsFailingPosts(t *testing.T) {
+	db := testdb.Open(t)
+	repos := postgres.NewRepositories(db)
+	posts := NewPostService(repos, NewPolicy(repos.Permissions))
+
+	user := &models.User{Username: "alice", PasswordHash: "-", Role: models.RoleUser}
+	if err := repos.Users.Create(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	// Публикация постов с текстом "broken ..." всегда падает
+	_, err := db.Exec(`
+        CREATE FUNCTION fail_broken_posts() RETURNS trigger AS $$
+        BEGIN
+            IF NEW.status = 'published' AND NEW.content LIKE 'broken%' THEN
+                RAISE EXCEPTION 'cannot publish %', NEW.id;
+            END IF;
+            RETURN NEW;
+        END
+        $$ LANGUAGE plpgsql;
+
+        CREATE TRIGGER fail_broken_posts BEFORE UPDATE ON posts
+        FOR EACH ROW EXECUTE FUNCTION fail_broken_posts();`)
+	if err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+
+	// Сломанные посты идут первыми и занимают всю пачку
+	schedule := func(content string) int {
+		t.Helper()
+		publishAt := time.Now().Add(time.Hour)
+		post, err := posts.CreateDraft(user.ID, content, "", nil, nil, &publishAt)
+		if err != nil {
+			t.Fatalf("create draft: %v", err)
+		}
+		return post.ID
+	}
+	var broken []int
+	for i := 0; i < publishBatchSize; i++ {
+		broken = append(broken, schedule(fmt.Sprintf("broken %d", i)))
+	}
+	good := schedule("good")
+
+	if _, err := db.Exec(`UPDATE posts SET publish_at = CURRENT_TIMESTAMP - INTERVAL '1 minute' * (1000 - id)`); err != nil {
+		t.Fatalf("make posts due: %v", err)
+	}
+
+	publisher := NewPublisher(repos, time.Hour)
+	done := make(chan struct{})
+	go func() {
+		publisher.tick()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("publisher did not finish")
+	}
+
+	status := func(postID int) string {
+		t.Helper()
+		post, err := repos.Posts.GetByID(postID, user.ID)
+		if err != nil {
+			t.Fatalf("get post: %v", err)
+		}
+		return post.Status
+	}
+	if got := status(good); got != models.PostStatusPublished {
+		t.Errorf("good post status = %q, want %q", got, models.PostStatusPublished)
+	}
+	if got := status(broken[0]); got != models.PostStatusScheduled {
+		t.Errorf("broken post status = %q, want %q", got, models.PostStatusScheduled)
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"errors"
+	"social-network/internal/models"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var ErrInvalidSearchQuery = errors.New("invalid search query")
+
+const (
+	maxSearchQueryLength = 256
+	searchDateLayout     = "2006-01-02"
+)
+
+// parseSearchQuery разбирает запрос вида
+//
+//	"точная фраза" слово from:alice #go since:2025-01-01 until:2025-01-31
+//
+// Операторы вынимаются из запроса, остальное уходит в полнотекстовый
+// поиск как есть. until включает указанный день.
+func parseSearchQuery(raw string) (*models.PostSearch, error) {
+	if len(raw) > maxSearchQueryLength {
+		return nil, ErrInvalidSearchQuery
+	}
+
+	search := &models.PostSearch{}
+	var text []string
+	for _, token := range splitSearchQuery(raw) {
+		lower := strings.ToLower(token)
+		switch {
+		case strings.HasPrefix(lower, "from:"):
+			author := strings.TrimPrefix(token[len("from:"):], "@")
+			if author == "" || !isValidMention(author) {
+				return nil, ErrInvalidSearchQuery
+			}
+			search.Author = author
+		case strings.HasPrefix(token, "#") && len(token) > 1:
+			hashtag := strings.TrimRight(token[1:], ".,!?")
+			if hashtag == "" || !isValidHashtag(hashtag) {
+				return nil, ErrInvalidSearchQuery
+			}
+			search.Hashtags = append(search.Hashtags, hashtag)
+		case strings.HasPrefix(lower, "since:"):
+			since, err := time.Parse(searchDateLayout, token[len("since:"):])
+			if err != nil {
+				return nil, ErrInvalidSearchQuery
+			}
+			search.Since = &since
+		case strings.HasPrefix(lower, "until:"):
+			until, err := time.Parse(searchDateLayout, token[len("until:"):])
+			if err != nil {
+				return nil, ErrInvalidSearchQuery
+			}
+			until = until.AddDate(0, 0, 1)
+			search.Until = &until
+		default:
+			text = append(text, token)
+		}
+	}
+
+	search.Text = strings.Join(text, " ")
+	if search.Text == "" && search.Author == "" && len(search.Hashtags) == 0 {
+		return nil, ErrInvalidSearchQuery
+	}
+	if search.Since != nil && search.Until != nil && !search.Since.Before(*search.Until) {
+		return nil, ErrInvalidSearchQuery
+	}
+	return search, nil
+}
+
+// Search - полнотекстовый поиск по видимым читателю постам
+func (s *PostServiceImpl) Search(query string, viewerID int, page, perPage int) ([]models.Post, error) {
+	search, err := parseSearchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return s.repos.Posts.Search(search, viewerID, page, perPage)
+}
+
+// splitSearchQuery делит запрос по пробелам, не разрывая фразы в кавычках.
+// Незакрытая кавычка закрывается в конце запроса.
+func splitSearchQuery(raw string) []string {
+	var (
+		tokens  []string
+		current strings.Builder
+		quoted  bool
+	)
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+
+	for _, r := range raw {
+		switch {
+		case r == '"':
+			current.WriteRune(r)
+			if quoted {
+				flush()
+			}
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if quoted {
+		current.WriteRune('"')
+	}
+	flush()
+
+	return tokens
+}
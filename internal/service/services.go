@@ -1,17 +1,51 @@
 package service
 
-import "social-network/internal/repository/postgres"
+import (
+	"social-network/internal/mailer"
+	"social-network/internal/repository/postgres"
+	"social-network/internal/security"
+	"social-network/internal/storage"
+)
+
+// Deps - внешние зависимости сервисов
+type Deps struct {
+	Mailer           mailer.Mailer
+	PasswordHasher   security.PasswordHasher
+	PasswordResetURL string
+	TOTPIssuer       string
+	BlobStore        storage.BlobStore
+}
 
 type Services struct {
-	Users   UserService
-	Posts   PostService
-	Follows FollowService
+	Users       UserService
+	Posts       PostService
+	Follows     FollowService
+	Sessions    SessionService
+	TwoFactor   TwoFactorService
+	Lockouts    LockoutService
+	Tokens      AccessTokenService
+	OAuth       OAuthService
+	Permissions PermissionService
+	Media       MediaService
+	Bookmarks   BookmarkService
+	Trends      TrendService
 }
 
-func NewServices(repos *postgres.Repositories) *Services {
+func NewServices(repos *postgres.Repositories, deps Deps) *Services {
+	policy := NewPolicy(repos.Permissions)
+
 	return &Services{
-		Users:   NewUserService(repos.Users),
-		Posts:   NewPostService(repos),
-		Follows: NewFollowService(repos.Follows),
+		Users:       NewUserService(repos, deps, policy),
+		Posts:       NewPostService(repos, policy),
+		Follows:     NewFollowService(repos.Follows),
+		Sessions:    NewSessionService(repos.Sessions),
+		TwoFactor:   NewTwoFactorService(repos, deps),
+		Lockouts:    NewLockoutService(repos, policy),
+		Tokens:      NewAccessTokenService(repos.Tokens),
+		OAuth:       NewOAuthService(repos),
+		Permissions: NewPermissionService(repos, policy),
+		Media:       NewMediaService(repos, deps.BlobStore, policy),
+		Bookmarks:   NewBookmarkService(repos, policy),
+		Trends:      NewTrendService(repos),
 	}
 }
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"social-network/internal/models"
+	"social-network/internal/repository/postgres"
+)
+
+type SessionService interface {
+	GetUserSessions(userID int) ([]models.Session, error)
+	Revoke(userID, sessionID int) error
+	RevokeAll(userID int) error
+}
+
+type SessionServiceImpl struct {
+	repo *postgres.SessionRepository
+}
+
+func NewSessionService(repo *postgres.SessionRepository) SessionService {
+	return &SessionServiceImpl{repo: repo}
+}
+
+func (s *SessionServiceImpl) GetUserSessions(userID int) ([]models.Session, error) {
+	return s.repo.GetUserSessions(userID)
+}
+
+// Revoke завершает сессию. Вместе со строкой сессии перестают действовать
+// ее refresh-токены, токены OAuth (каскадом) и уже выданные JWT:
+// JWTManager.ValidateAccessToken проверяет, что сессия из sid еще жива.
+func (s *SessionServiceImpl) Revoke(userID, sessionID int) error {
+	return s.repo.DeleteUserSession(userID, sessionID)
+}
+
+// RevokeAll завершает все сессии пользователя, включая текущую. Как и
+// в Revoke, JWT этих сессий отклоняются со следующего запроса.
+func (s *SessionServiceImpl) RevokeAll(userID int) error {
+	return s.repo.DeleteAllUserSessions(userID)
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"social-network/internal/handler/auth"
+	"social-network/internal/models"
+	"social-network/internal/repository/postgres"
+	"social-network/internal/security"
+	"social-network/internal/testdb"
+	"testing"
+	"time"
+)
+
+// Дешевые параметры, чтобы тесты не тратили время на хэширование
+var testHasher = security.NewArgon2idHasher(security.Argon2Params{
+	Memory:      64,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+})
+
+type sessionFixture struct {
+	repos    *postgres.Repositories
+	jwt      *auth.JWTManager
+	sessions SessionService
+	users    UserService
+}
+
+func newSessionFixture(t *testing.T) *sessionFixture {
+	t.Helper()
+
+	repos := postgres.NewRepositories(testdb.Open(t))
+	keys := []auth.JWTKey{{ID: "k1", Algorithm: auth.AlgHS256, Secret: []byte("0123456789abcdef0123456789abcdef")}}
+	jwt, err := auth.NewJWTManager(keys, "k1", 15*time.Minute, time.Hour, repos.Sessions)
+	if err != nil {
+		t.Fatalf("new jwt manager: %v", err)
+	}
+
+	return &sessionFixture{
+		repos:    repos,
+		jwt:      jwt,
+		sessions: NewSessionService(repos.Sessions),
+		users:    NewUserService(repos, Deps{PasswordHasher: testHasher}, NewPolicy(repos.Permissions)),
+	}
+}
+
+func (f *sessionFixture) createUser(t *testing.T, username, password string) int {
+	t.Helper()
+	hash, err := testHasher.Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{Username: username, PasswordHash: hash, Role: models.RoleUser}
+	if err := f.repos.Users.Create(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user.ID
+}
+
+func (f *sessionFixture) login(t *testing.T, userID int, device string) (*auth.TokenPair, int) {
+	t.Helper()
+	pair, err := f.jwt.IssueTokens(userID, device, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("issue tokens: %v", err)
+	}
+	claims, err := f.jwt.ValidateAccessToken(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("validate fresh token: %v", err)
+	}
+	return pair, claims.SessionID
+}
+
+func checkRevoked(t *testing.T, jwt *auth.JWTManager, name string, pair *auth.TokenPair) {
+	t.Helper()
+	if _, err := jwt.ValidateAccessToken(pair.AccessToken); err != auth.ErrRevokedJWT {
+		t.Errorf("%s access token: err = %v, want %v", name, err, auth.ErrRevokedJWT)
+	}
+	if _, err := jwt.Refresh(pair.RefreshToken); err == nil {
+		t.Errorf("%s refresh token still works", name)
+	}
+}
+
+func checkActive(t *testing.T, jwt *auth.JWTManager, name string, pair *auth.TokenPair) {
+	t.Helper()
+	if _, err := jwt.ValidateAccessToken(pair.AccessToken); err != nil {
+		t.Errorf("%s access token: %v", name, err)
+	}
+}
+
+func TestSessionIsActive(t *testing.T) {
+	f := newSessionFixture(t)
+	userID := f.createUser(t, "alice", "password")
+
+	_, sessionID := f.login(t, userID, "laptop")
+	if active, err := f.repos.Sessions.IsActive(sessionID); err != nil || !active {
+		t.Errorf("IsActive(live) = %v, %v", active, err)
+	}
+
+	expired := &models.Session{UserID: userID, ExpiresAt: time.Now().Add(-time.Minute)}
+	if err := f.repos.Sessions.Create(expired); err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	if active, err := f.repos.Sessions.IsActive(expired.ID); err != nil || active {
+		t.Errorf("IsActive(expired) = %v, %v", active, err)
+	}
+
+	if err := f.sessions.Revoke(userID, sessionID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if active, err := f.repos.Sessions.IsActive(sessionID); err != nil || active {
+		t.Errorf("IsActive(revoked) = %v, %v", active, err)
+	}
+}
+
+// DELETE /api/sessions/{id}: гаснет только выбранная сессия, и чужую
+// сессию так завершить нельзя
+func TestRevokeSessionRejectsAccessTokens(t *testing.T) {
+	f := newSessionFixture(t)
+	alice := f.createUser(t, "alice", "password")
+	bob := f.createUser(t, "bob", "password")
+
+	laptop, laptopID := f.login(t, alice, "laptop")
+	phone, _ := f.login(t, alice, "phone")
+	other, otherID := f.login(t, bob, "other")
+
+	if err := f.sessions.Revoke(alice, otherID); err != postgres.ErrSessionNotFound {
+		t.Errorf("revoke another user's session: err = %v, want %v", err, postgres.ErrSessionNotFound)
+	}
+	if err := f.sessions.Revoke(alice, laptopID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+
+	checkRevoked(t, f.jwt, "revoked", laptop)
+	checkActive(t, f.jwt, "other device", phone)
+	checkActive(t, f.jwt, "other user", other)
+}
+
+// "Выйти на всех устройствах" и смена пароля завершают все сессии
+// пользователя, и его JWT отклоняются со следующего запроса
+func TestRevokeAllRejectsAccessTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(f *sessionFixture, userID int) error
+	}{
+		{"revoke all", func(f *sessionFixture, userID int) error {
+			return f.sessions.RevokeAll(userID)
+		}},
+		{"change password", func(f *sessionFixture, userID int) error {
+			return f.users.ChangePassword(userID, "password", "new password")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newSessionFixture(t)
+			alice := f.createUser(t, "alice", "password")
+			bob := f.createUser(t, "bob", "password")
+
+			laptop, _ := f.login(t, alice, "laptop")
+			phone, _ := f.login(t, alice, "phone")
+			other, _ := f.login(t, bob, "other")
+
+			if err := tt.revoke(f, alice); err != nil {
+				t.Fatalf("revoke: %v", err)
+			}
+
+			checkRevoked(t, f.jwt, "laptop", laptop)
+			checkRevoked(t, f.jwt, "phone", phone)
+			checkActive(t, f.jwt, "other user", other)
+		})
+	}
+}
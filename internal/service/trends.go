@@ -0,0 +1,103 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"social-network/internal/models"
+	"social-network/internal/repository/postgres"
+	"time"
+)
+
+const (
+	// Ключ advisory-блокировки, которой выбирается лидер агрегатора трендов
+	trendsLockKey int64 = 17002
+	// Хэштег попадает в тренды, если за окно его использовали хотя бы столько раз
+	trendMinUses = 2
+	// Сколько хэштегов хранится в топе каждого окна
+	trendTopSize = 100
+
+	DefaultTrendWindow = "24h"
+)
+
+var ErrUnknownTrendWindow = errors.New("unknown trend window")
+
+// trendWindows - окна трендов. Норму для окна считаем по периоду перед
+// ним, в несколько раз длиннее самого окна.
+var trendWindows = []postgres.TrendWindow{
+	{Name: "1h", Length: time.Hour, Baseline: 24 * time.Hour},
+	{Name: "24h", Length: 24 * time.Hour, Baseline: 7 * 24 * time.Hour},
+	{Name: "7d", Length: 7 * 24 * time.Hour, Baseline: 28 * 24 * time.Hour},
+}
+
+type TrendService interface {
+	GetTrending(window string, page, perPage int) ([]models.HashtagTrend, error)
+}
+
+type TrendServiceImpl struct {
+	repos *postgres.Repositories
+}
+
+func NewTrendService(repos *postgres.Repositories) TrendService {
+	return &TrendServiceImpl{repos: repos}
+}
+
+// GetTrending отдает топ из таблицы, которую заполняет TrendAggregator
+func (s *TrendServiceImpl) GetTrending(window string, page, perPage int) ([]models.HashtagTrend, error) {
+	if !isTrendWindow(window) {
+		return nil, ErrUnknownTrendWindow
+	}
+	return s.repos.Trends.GetTrending(window, page, perPage)
+}
+
+func isTrendWindow(name string) bool {
+	for _, w := range trendWindows {
+		if w.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// TrendAggregator периодически пересчитывает тренды хэштегов. Как и
+// Publisher, запускается на всех экземплярах, а работает только лидер.
+type TrendAggregator struct {
+	trends   *postgres.HashtagTrendRepository
+	leader   *postgres.LeaderLock
+	interval time.Duration
+}
+
+func NewTrendAggregator(repos *postgres.Repositories, interval time.Duration) *TrendAggregator {
+	return &TrendAggregator{
+		trends:   repos.Trends,
+		leader:   repos.Locks.Leader(trendsLockKey),
+		interval: interval,
+	}
+}
+
+// Run пересчитывает тренды каждые interval, пока работает процесс
+func (a *TrendAggregator) Run() {
+	a.tick()
+
+	ticker := time.NewTicker(a.interval)
+	for range ticker.C {
+		a.tick()
+	}
+}
+
+func (a *TrendAggregator) tick() {
+	leader, err := a.leader.Acquire()
+	if err != nil {
+		log.Printf("trends: %v", err)
+		return
+	}
+	if !leader {
+		return
+	}
+
+	now := time.Now()
+	for _, window := range trendWindows {
+		if err := a.trends.Refresh(window, now, trendMinUses, trendTopSize); err != nil {
+			log.Printf("trends: window %s: %v", window.Name, err)
+		}
+	}
+}
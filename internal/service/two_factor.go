@@ -0,0 +1,199 @@
+package service
+
+import (
+	"errors"
+	"social-network/internal/models"
+	"social-network/internal/repository/postgres"
+	"social-network/internal/security"
+	"time"
+)
+
+var (
+	ErrTwoFactorRequired   = errors.New("two-factor authentication required")
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication already enabled")
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication not enabled")
+	ErrTwoFactorNotSetUp   = errors.New("two-factor authentication not set up")
+	ErrInvalidTOTPCode     = errors.New("invalid two-factor code")
+)
+
+const (
+	recoveryCodesCount = 10
+	loginChallengeTTL  = 5 * time.Minute
+)
+
+type TOTPSetup struct {
+	Secret          string
+	ProvisioningURI string
+}
+
+type TwoFactorService interface {
+	Setup(userID int) (*TOTPSetup, error)
+	Enable(userID int, code string) ([]string, error)
+	Disable(userID int, code string) error
+	RegenerateRecoveryCodes(userID int, code string) ([]string, error)
+	BeginLogin(userID int) (string, error)
+	CompleteLogin(challengeToken, code string) (int, error)
+}
+
+type TwoFactorServiceImpl struct {
+	users  *postgres.UserRepository
+	repo   *postgres.TwoFactorRepository
+	issuer string
+}
+
+func NewTwoFactorService(repos *postgres.Repositories, deps Deps) TwoFactorService {
+	return &TwoFactorServiceImpl{
+		users:  repos.Users,
+		repo:   repos.TwoFactor,
+		issuer: deps.TOTPIssuer,
+	}
+}
+
+// Setup выдает новый секрет. 2FA включится только после Enable с верным кодом.
+func (s *TwoFactorServiceImpl) Setup(userID int) (*TOTPSetup, error) {
+	user, err := s.users.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret := security.GenerateTOTPSecret()
+	if err := s.repo.SetSecret(userID, secret); err != nil {
+		return nil, err
+	}
+
+	return &TOTPSetup{
+		Secret:          secret,
+		ProvisioningURI: security.TOTPProvisioningURI(s.issuer, user.Username, secret),
+	}, nil
+}
+
+// Enable подтверждает секрет кодом и возвращает коды восстановления.
+// Они показываются пользователю один раз, в БД хранятся только хэши.
+func (s *TwoFactorServiceImpl) Enable(userID int, code string) ([]string, error) {
+	user, err := s.users.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotSetUp
+	}
+
+	step, ok := security.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTOTPCode
+	}
+
+	codes, hashes := newRecoveryCodes()
+	if err := s.repo.Enable(userID, step, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (s *TwoFactorServiceImpl) Disable(userID int, code string) error {
+	user, err := s.users.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if err := s.verifyCode(user, code); err != nil {
+		return err
+	}
+
+	return s.repo.Disable(userID)
+}
+
+func (s *TwoFactorServiceImpl) RegenerateRecoveryCodes(userID int, code string) ([]string, error) {
+	user, err := s.users.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrTwoFactorNotEnabled
+	}
+
+	if err := s.verifyCode(user, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes := newRecoveryCodes()
+	if err := s.repo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// BeginLogin вызывается после проверки пароля и возвращает
+// короткоживущий токен для второго шага входа
+func (s *TwoFactorServiceImpl) BeginLogin(userID int) (string, error) {
+	token := security.GenerateToken()
+	if err := s.repo.CreateChallenge(userID, security.HashToken(token), time.Now().Add(loginChallengeTTL)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (s *TwoFactorServiceImpl) CompleteLogin(challengeToken, code string) (int, error) {
+	tokenHash := security.HashToken(challengeToken)
+	userID, err := s.repo.AttemptChallenge(tokenHash)
+	if err != nil {
+		return 0, err
+	}
+
+	user, err := s.users.GetByID(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.verifyCode(user, code); err != nil {
+		return 0, err
+	}
+
+	if err := s.repo.DeleteChallenge(tokenHash); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// verifyCode принимает либо TOTP-код из приложения, либо код восстановления
+func (s *TwoFactorServiceImpl) verifyCode(user *models.User, code string) error {
+	if step, ok := security.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		if err := s.repo.UseTOTPStep(user.ID, step); err != nil {
+			if err == postgres.ErrTOTPCodeReused {
+				return ErrInvalidTOTPCode
+			}
+			return err
+		}
+		return nil
+	}
+
+	codeHash := security.HashToken(security.NormalizeRecoveryCode(code))
+	if err := s.repo.UseRecoveryCode(user.ID, codeHash); err != nil {
+		if err == postgres.ErrInvalidRecoveryCode {
+			return ErrInvalidTOTPCode
+		}
+		return err
+	}
+	return nil
+}
+
+func newRecoveryCodes() ([]string, []string) {
+	codes := security.GenerateRecoveryCodes(recoveryCodesCount)
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = security.HashToken(code)
+	}
+	return codes, hashes
+}
@@ -2,18 +2,29 @@ package service
 
 import (
 	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"social-network/internal/mailer"
 	"social-network/internal/models"
 	"social-network/internal/repository/postgres"
+	"social-network/internal/security"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 var (
 	ErrInvalidCredentials = errors.New("user not found")
 	ErrNotAdmin           = errors.New("you are not admin")
 	ErrUnknownRole        = errors.New("unknown role")
+	ErrWrongPassword      = errors.New("wrong password")
 )
 
+const passwordResetTTL = time.Hour
+
 type UserService interface {
-	Register(username, password string) error
+	Register(username, password, email string) error
 	ValidateUser(username, password string) (*models.User, error)
 	GetUserByUsername(username string) (*models.User, error)
 	Follow(followerID, followingID int) error
@@ -21,26 +32,71 @@ type UserService interface {
 	GetFollowers(userID int, page, perPage int) ([]models.User, error)
 	GetFollowing(userID int, page, perPage int) ([]models.User, error)
 	GetMutualFollows(userID int, page, perPage int) ([]models.User, error)
+	Search(query string, viewerID int, page, perPage int) ([]models.User, error)
 	DeleteAccount(userID, toDeleteID int, withPosts bool) error
 	UpdateRole(adminID int, targetUserID int, newRole string) error
+	ChangePassword(userID int, currentPassword, newPassword string) error
+	RequestPasswordReset(email string) error
+	ResetPassword(token, newPassword string) error
 }
 
 type UserServiceImpl struct {
-	repo *postgres.UserRepository
+	repo     *postgres.UserRepository
+	sessions *postgres.SessionRepository
+	mailer   mailer.Mailer
+	hasher   security.PasswordHasher
+	resetURL string
+	policy   *Policy
+	// Хэш, с которым сверяем пароль несуществующего пользователя,
+	// чтобы время ответа не выдавало, есть ли такой логин
+	dummyHash string
 }
 
-func NewUserService(repo *postgres.UserRepository) UserService {
-	return &UserServiceImpl{repo: repo}
+func NewUserService(repos *postgres.Repositories, deps Deps, policy *Policy) UserService {
+	dummyHash, err := deps.PasswordHasher.Hash(security.GenerateToken())
+	if err != nil {
+		log.Printf("generate dummy password hash: %v", err)
+	}
+
+	return &UserServiceImpl{
+		repo:      repos.Users,
+		sessions:  repos.Sessions,
+		mailer:    deps.Mailer,
+		hasher:    deps.PasswordHasher,
+		resetURL:  deps.PasswordResetURL,
+		policy:    policy,
+		dummyHash: dummyHash,
+	}
 }
 
+// ValidateUser проверяет пароль и при необходимости
+// перехэширует его текущим алгоритмом
 func (s *UserServiceImpl) ValidateUser(username, password string) (*models.User, error) {
-	return s.repo.ValidatePassword(username, password)
+	user, err := s.repo.GetByUsername(username)
+	if err == postgres.ErrUserNotFound {
+		s.hasher.Verify(password, s.dummyHash)
+		return nil, postgres.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.verifyPassword(user, password); err != nil {
+		return nil, err
+	}
+	return user, nil
 }
 
-func (s *UserServiceImpl) Register(username, password string) error {
+func (s *UserServiceImpl) Register(username, password, email string) error {
+	passwordHash, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
 	user := &models.User{
 		Username:     username,
-		PasswordHash: password,
+		Email:        email,
+		PasswordHash: passwordHash,
 		Role:         models.RoleUser,
 	}
 	return s.repo.Create(user)
@@ -54,10 +110,16 @@ func (s *UserServiceImpl) Follow(followerID, followingID int) error {
 	if followerID == followingID {
 		return errors.New("cannot follow yourself")
 	}
+	if err := s.authorize(followerID, models.PermUserFollow); err != nil {
+		return err
+	}
 	return s.repo.CreateFollow(followerID, followingID)
 }
 
 func (s *UserServiceImpl) Unfollow(followerID, followingID int) error {
+	if err := s.authorize(followerID, models.PermUserFollow); err != nil {
+		return err
+	}
 	return s.repo.DeleteFollow(followerID, followingID)
 }
 
@@ -73,38 +135,152 @@ func (s *UserServiceImpl) GetMutualFollows(userID int, page, perPage int) ([]mod
 	return s.repo.GetMutualFollows(userID, page, perPage)
 }
 
+// Search - поиск пользователей для автодополнения, "@" в начале не важен
+func (s *UserServiceImpl) Search(query string, viewerID int, page, perPage int) ([]models.User, error) {
+	query = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(query), "@"))
+	if query == "" || utf8.RuneCountInString(query) > 50 {
+		return nil, ErrInvalidSearchQuery
+	}
+	return s.repo.Search(query, viewerID, page, perPage)
+}
+
 func (s *UserServiceImpl) DeleteAccount(userID, toDeleteID int, withPosts bool) error {
+	permission := models.PermUserDeleteAny
 	if userID == toDeleteID {
-		return s.repo.Delete(toDeleteID, withPosts)
+		permission = models.PermUserDeleteOwn
 	}
+	if err := s.authorize(userID, permission); err != nil {
+		if err == ErrPermissionDenied {
+			return ErrNotAdmin
+		}
+		return err
+	}
+
+	return s.repo.Delete(toDeleteID, withPosts)
+}
 
+func (s *UserServiceImpl) UpdateRole(adminID int, targetUserID int, newRole string) error {
+	if err := s.authorize(adminID, models.PermUserRoleUpdate); err != nil {
+		if err == ErrPermissionDenied {
+			return ErrNotAdmin
+		}
+		return err
+	}
+
+	newRoleModel := getRole(newRole)
+	if newRoleModel == nil {
+		return ErrUnknownRole
+	}
+
+	return s.repo.UpdateRole(targetUserID, *newRoleModel)
+}
+
+// ChangePassword меняет пароль и завершает все сессии пользователя
+func (s *UserServiceImpl) ChangePassword(userID int, currentPassword, newPassword string) error {
 	user, err := s.repo.GetByID(userID)
 	if err != nil {
 		return err
 	}
 
-	if !(user.Role == models.RoleAdmin || user.Role == models.RoleModerator) {
-		return ErrNotAdmin
+	if err := s.verifyPassword(user, currentPassword); err != nil {
+		if err == postgres.ErrUserNotFound {
+			return ErrWrongPassword
+		}
+		return err
 	}
 
-	return s.repo.Delete(toDeleteID, withPosts)
+	passwordHash, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.UpdatePasswordHash(userID, passwordHash); err != nil {
+		return err
+	}
+
+	return s.sessions.DeleteAllUserSessions(userID)
 }
 
-func (s *UserServiceImpl) UpdateRole(adminID int, targetUserID int, newRole string) error {
-	admin, err := s.repo.GetByID(adminID)
+// RequestPasswordReset отправляет ссылку для сброса пароля. Для неизвестной
+// почты молча ничего не делает, чтобы не раскрывать зарегистрированные адреса.
+// По той же причине письмо уходит в фоне, а ошибка отправки только пишется в
+// лог: иначе известную почту выдали бы код ответа или время отправки.
+func (s *UserServiceImpl) RequestPasswordReset(email string) error {
+	user, err := s.repo.GetByEmail(email)
+	if err == postgres.ErrUserNotFound {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
-	if admin.Role != models.RoleAdmin {
-		return ErrNotAdmin
+
+	token := security.GenerateToken()
+	if err := s.repo.CreatePasswordReset(user.ID, security.HashToken(token), time.Now().Add(passwordResetTTL)); err != nil {
+		return err
 	}
 
-	newRoleModel := getRole(newRole)
-	if newRoleModel == nil {
-		return ErrUnknownRole
+	go s.sendPasswordReset(user, token)
+	return nil
+}
+
+func (s *UserServiceImpl) sendPasswordReset(user *models.User, token string) {
+	link := s.resetURL + "?token=" + url.QueryEscape(token)
+	err := s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf(
+			"Hi, %s!\n\nTo set a new password, follow the link below. It is valid for %d minutes.\n\n%s\n\nIf you did not request a password reset, ignore this email.",
+			user.Username, int(passwordResetTTL.Minutes()), link,
+		),
+	})
+	if err != nil {
+		log.Printf("password reset mail for user %d: %v", user.ID, err)
 	}
+}
 
-	return s.repo.UpdateRole(targetUserID, *newRoleModel)
+func (s *UserServiceImpl) ResetPassword(token, newPassword string) error {
+	passwordHash, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	userID, err := s.repo.ResetPassword(security.HashToken(token), passwordHash)
+	if err != nil {
+		return err
+	}
+
+	return s.sessions.DeleteAllUserSessions(userID)
+}
+
+func (s *UserServiceImpl) authorize(userID int, permission string) error {
+	user, err := s.repo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	return s.policy.Authorize(user, permission)
+}
+
+// verifyPassword возвращает ErrUserNotFound при неверном пароле,
+// как это делала проверка пароля на стороне БД
+func (s *UserServiceImpl) verifyPassword(user *models.User, password string) error {
+	ok, needsRehash, err := s.hasher.Verify(password, user.PasswordHash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return postgres.ErrUserNotFound
+	}
+
+	if needsRehash {
+		passwordHash, err := s.hasher.Hash(password)
+		if err == nil {
+			err = s.repo.UpdatePasswordHash(user.ID, passwordHash)
+		}
+		if err != nil {
+			log.Printf("rehash password for user %d: %v", user.ID, err)
+		}
+	}
+	return nil
 }
 
 func getRole(role string) *models.UserRole {
@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Store - S3-совместимое хранилище (AWS S3, MinIO и т.п.). Адресация
+// по пути (endpoint/bucket/key), поэтому работает и с MinIO без DNS.
+// Запросы подписываются AWS Signature Version 4.
+type S3Store struct {
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+func NewS3Store(endpoint, region, bucket, accessKey, secretKey string) *S3Store {
+	return &S3Store{
+		endpoint:  strings.TrimRight(endpoint, "/"),
+		region:    region,
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (s *S3Store) Put(key string, data []byte, contentType string) error {
+	req, err := s.newRequest(http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.do(req, data)
+	if err != nil {
+		return fmt.Errorf("put object: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("put object: %s", readS3Error(resp))
+	}
+	return nil
+}
+
+func (s *S3Store) Get(key string) (io.ReadCloser, error) {
+	req, err := s.newRequest(http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(req, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get object: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, ErrBlobNotFound
+	default:
+		defer resp.Body.Close()
+		return nil, fmt.Errorf("get object: %s", readS3Error(resp))
+	}
+}
+
+func (s *S3Store) Delete(key string) error {
+	req, err := s.newRequest(http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(req, nil)
+	if err != nil {
+		return fmt.Errorf("delete object: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// S3 отвечает 204 и на удаление несуществующего объекта
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("delete object: %s", readS3Error(resp))
+	}
+	return nil
+}
+
+func (s *S3Store) newRequest(method, key string, body []byte) (*http.Request, error) {
+	rawURL := s.endpoint + "/" + s.bucket + "/" + encodeS3Path(key)
+	req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	return req, nil
+}
+
+func (s *S3Store) do(req *http.Request, body []byte) (*http.Response, error) {
+	signV4(req, body, s.accessKey, s.secretKey, s.region, time.Now())
+	return s.client.Do(req)
+}
+
+func readS3Error(resp *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Sprintf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// signV4 подписывает запрос к S3 по схеме AWS Signature Version 4.
+// Подписываются host, content-type, range и все x-amz-* заголовки.
+func signV4(req *http.Request, body []byte, accessKey, secretKey, region string, now time.Time) {
+	const service = "s3"
+
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" || lower == "range" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature,
+	))
+}
+
+func canonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		vals := append([]string(nil), values[key]...)
+		sort.Strings(vals)
+		for _, value := range vals {
+			parts = append(parts, awsEscape(key)+"="+awsEscape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// encodeS3Path кодирует ключ посегментно, сохраняя слэши
+func encodeS3Path(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = awsEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// awsEscape - URI-кодирование в понимании AWS: не кодируются только
+// незарезервированные символы RFC 3986
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,16 @@
+package storage
+
+import (
+	"errors"
+	"io"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore хранит загруженные файлы. Ключи выдает сервис, это пути
+// вида "media/abc.jpg" без ведущего слэша.
+type BlobStore interface {
+	Put(key string, data []byte, contentType string) error
+	Get(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
@@ -0,0 +1,22 @@
+-- +goose Up
+
+-- Сессии, выданные по refresh-токену, не имеют собственного токена
+ALTER TABLE sessions ALTER COLUMN token_hash DROP NOT NULL;
+
+-- Refresh-токены. Семья токенов = сессия, при повторном
+-- использовании токена удаляется вся сессия вместе с семьей
+CREATE TABLE refresh_tokens (
+    id SERIAL PRIMARY KEY,
+    session_id INTEGER NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_refresh_tokens_session ON refresh_tokens(session_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS refresh_tokens;
+DELETE FROM sessions WHERE token_hash IS NULL;
+ALTER TABLE sessions ALTER COLUMN token_hash SET NOT NULL;
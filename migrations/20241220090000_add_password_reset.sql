@@ -0,0 +1,20 @@
+-- +goose Up
+
+-- Почта нужна для восстановления пароля, поэтому необязательна
+ALTER TABLE users ADD COLUMN email VARCHAR(255) UNIQUE;
+
+-- Одноразовые токены сброса пароля
+CREATE TABLE password_reset_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_password_reset_tokens_user ON password_reset_tokens(user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS password_reset_tokens;
+ALTER TABLE users DROP COLUMN IF EXISTS email;
@@ -0,0 +1,36 @@
+-- +goose Up
+
+-- TOTP: секрет появляется при настройке, включается после подтверждения кодом.
+-- totp_last_step - последний принятый шаг времени, защита от повтора кода
+ALTER TABLE users
+    ADD COLUMN totp_secret VARCHAR(64),
+    ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+-- Одноразовые коды восстановления
+CREATE TABLE recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    used_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (user_id, code_hash)
+);
+
+-- Второй шаг входа: пароль уже проверен, ждем код
+CREATE TABLE login_challenges (
+    id SERIAL PRIMARY KEY,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS login_challenges;
+DROP TABLE IF EXISTS recovery_codes;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS totp_last_step,
+    DROP COLUMN IF EXISTS totp_enabled,
+    DROP COLUMN IF EXISTS totp_secret;
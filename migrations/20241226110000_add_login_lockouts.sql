@@ -0,0 +1,28 @@
+-- +goose Up
+
+-- Счетчики неудачных входов по имени пользователя и по IP
+CREATE TABLE login_attempts (
+    kind VARCHAR(16) NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (kind, key)
+);
+
+-- Журнал событий безопасности
+CREATE TABLE security_events (
+    id SERIAL PRIMARY KEY,
+    event_type VARCHAR(50) NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    details TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_security_events_user ON security_events(user_id);
+CREATE INDEX idx_security_events_created ON security_events(created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS security_events;
+DROP TABLE IF EXISTS login_attempts;
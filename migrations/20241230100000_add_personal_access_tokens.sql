@@ -0,0 +1,18 @@
+-- +goose Up
+
+-- Персональные токены для ботов и интеграций
+CREATE TABLE personal_access_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    last_used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_personal_access_tokens_user ON personal_access_tokens(user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS personal_access_tokens;
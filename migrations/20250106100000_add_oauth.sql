@@ -0,0 +1,61 @@
+-- +goose Up
+
+-- Сторонние приложения. Публичные клиенты (SPA, мобильные) не имеют секрета
+-- и защищены только PKCE
+CREATE TABLE oauth_clients (
+    id SERIAL PRIMARY KEY,
+    client_id VARCHAR(64) UNIQUE NOT NULL,
+    client_secret_hash VARCHAR(64),
+    name VARCHAR(100) NOT NULL,
+    owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uris TEXT[] NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_oauth_clients_owner ON oauth_clients(owner_id);
+
+-- Согласия пользователей на доступ приложений
+CREATE TABLE oauth_consents (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id INTEGER NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, client_id)
+);
+
+-- Коды авторизации, одноразовые и короткоживущие
+CREATE TABLE oauth_authorization_codes (
+    code_hash VARCHAR(64) PRIMARY KEY,
+    client_id INTEGER NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    code_challenge VARCHAR(128) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- Токены приложений. Каждая выдача - отдельная сессия пользователя:
+-- приложение видно в списке сессий, а отзыв сессии или смена пароля
+-- отзывают и его токены
+CREATE TABLE oauth_tokens (
+    id SERIAL PRIMARY KEY,
+    session_id INTEGER NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    client_id INTEGER NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    access_token_hash VARCHAR(64) UNIQUE NOT NULL,
+    refresh_token_hash VARCHAR(64) UNIQUE NOT NULL,
+    scopes TEXT[] NOT NULL,
+    access_expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_oauth_tokens_session ON oauth_tokens(session_id);
+CREATE INDEX idx_oauth_tokens_user_client ON oauth_tokens(user_id, client_id);
+
+-- +goose Down
+DELETE FROM sessions WHERE id IN (SELECT session_id FROM oauth_tokens);
+DROP TABLE IF EXISTS oauth_tokens;
+DROP TABLE IF EXISTS oauth_authorization_codes;
+DROP TABLE IF EXISTS oauth_consents;
+DROP TABLE IF EXISTS oauth_clients;
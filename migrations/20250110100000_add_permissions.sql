@@ -0,0 +1,59 @@
+-- +goose Up
+
+-- Именованные права. Привилегированные права можно использовать
+-- только с включенной 2FA
+CREATE TABLE permissions (
+    name VARCHAR(64) PRIMARY KEY,
+    description TEXT NOT NULL,
+    privileged BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+-- Матрица "роль - право", редактируется администраторами через API
+CREATE TABLE role_permissions (
+    role user_role NOT NULL,
+    permission VARCHAR(64) NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+    PRIMARY KEY (role, permission)
+);
+
+INSERT INTO permissions (name, description, privileged) VALUES
+    ('post.create', 'Create posts', FALSE),
+    ('post.edit.own', 'Edit own posts', FALSE),
+    ('post.edit.any', 'Edit posts of other users', TRUE),
+    ('post.delete.own', 'Delete own posts', FALSE),
+    ('post.delete.any', 'Delete posts of other users', TRUE),
+    ('user.follow', 'Follow and unfollow users', FALSE),
+    ('user.delete.own', 'Delete own account', FALSE),
+    ('user.delete.any', 'Delete accounts of other users', TRUE),
+    ('user.role.update', 'Change user roles', TRUE),
+    ('lockout.clear', 'Clear login lockouts', TRUE),
+    ('permission.manage', 'Edit the role permission matrix', TRUE);
+
+-- Начальная матрица повторяет прежние проверки в коде
+INSERT INTO role_permissions (role, permission) VALUES
+    ('user', 'post.create'),
+    ('user', 'post.edit.own'),
+    ('user', 'post.delete.own'),
+    ('user', 'user.follow'),
+    ('user', 'user.delete.own'),
+    ('moderator', 'post.create'),
+    ('moderator', 'post.edit.own'),
+    ('moderator', 'post.edit.any'),
+    ('moderator', 'post.delete.own'),
+    ('moderator', 'user.follow'),
+    ('moderator', 'user.delete.own'),
+    ('moderator', 'user.delete.any'),
+    ('admin', 'post.create'),
+    ('admin', 'post.edit.own'),
+    ('admin', 'post.edit.any'),
+    ('admin', 'post.delete.own'),
+    ('admin', 'post.delete.any'),
+    ('admin', 'user.follow'),
+    ('admin', 'user.delete.own'),
+    ('admin', 'user.delete.any'),
+    ('admin', 'user.role.update'),
+    ('admin', 'lockout.clear'),
+    ('admin', 'permission.manage');
+
+-- +goose Down
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
@@ -0,0 +1,22 @@
+-- +goose Up
+
+-- Ответы на посты. root_id - первый пост ветки, reply_to_user_id - автор
+-- поста, на который отвечают. is_reply остается TRUE, даже если родителя
+-- удалили, чтобы ответ не всплыл в ленте как обычный пост.
+ALTER TABLE posts
+    ADD COLUMN parent_id INTEGER REFERENCES posts(id) ON DELETE SET NULL,
+    ADD COLUMN root_id INTEGER REFERENCES posts(id) ON DELETE SET NULL,
+    ADD COLUMN reply_to_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN is_reply BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX idx_posts_parent ON posts(parent_id);
+CREATE INDEX idx_posts_root ON posts(root_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_posts_root;
+DROP INDEX IF EXISTS idx_posts_parent;
+ALTER TABLE posts
+    DROP COLUMN IF EXISTS is_reply,
+    DROP COLUMN IF EXISTS reply_to_user_id,
+    DROP COLUMN IF EXISTS root_id,
+    DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,24 @@
+-- +goose Up
+
+-- Лайки. Счетчики считаются по этой таблице, а каскадное удаление
+-- вместе с постом или пользователем держит их точными
+CREATE TABLE post_likes (
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (post_id, user_id)
+);
+
+CREATE INDEX idx_post_likes_user ON post_likes(user_id, created_at);
+
+INSERT INTO permissions (name, description, privileged) VALUES
+    ('post.like', 'Like posts', FALSE);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('user', 'post.like'),
+    ('moderator', 'post.like'),
+    ('admin', 'post.like');
+
+-- +goose Down
+DELETE FROM permissions WHERE name = 'post.like';
+DROP TABLE IF EXISTS post_likes;
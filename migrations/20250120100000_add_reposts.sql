@@ -0,0 +1,36 @@
+-- +goose Up
+
+-- Репосты. Удаление поста или пользователя удаляет и репосты, поэтому
+-- в лентах не остается ссылок на несуществующие посты
+CREATE TABLE reposts (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, post_id)
+);
+
+CREATE INDEX idx_reposts_post ON reposts(post_id);
+
+-- Цитаты. Если оригинал удалили, цитата остается, а is_quote позволяет
+-- показать, что цитируемый пост недоступен
+ALTER TABLE posts
+    ADD COLUMN quote_of_id INTEGER REFERENCES posts(id) ON DELETE SET NULL,
+    ADD COLUMN is_quote BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX idx_posts_quote_of ON posts(quote_of_id);
+
+INSERT INTO permissions (name, description, privileged) VALUES
+    ('post.repost', 'Repost posts', FALSE);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('user', 'post.repost'),
+    ('moderator', 'post.repost'),
+    ('admin', 'post.repost');
+
+-- +goose Down
+DELETE FROM permissions WHERE name = 'post.repost';
+DROP INDEX IF EXISTS idx_posts_quote_of;
+ALTER TABLE posts
+    DROP COLUMN IF EXISTS is_quote,
+    DROP COLUMN IF EXISTS quote_of_id;
+DROP TABLE IF EXISTS reposts;
@@ -0,0 +1,14 @@
+-- +goose Up
+
+-- Упоминания @username. Хранятся только упоминания существующих
+-- пользователей, при удалении пользователя они исчезают
+CREATE TABLE post_mentions (
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (post_id, user_id)
+);
+
+CREATE INDEX idx_post_mentions_user ON post_mentions(user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS post_mentions;
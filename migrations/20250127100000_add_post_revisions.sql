@@ -0,0 +1,39 @@
+-- +goose Up
+
+-- last_editor_id - автор текущей версии текста. NULL только если этого
+-- пользователя удалили, поэтому для старых постов проставляем автора
+ALTER TABLE posts
+    ADD COLUMN last_editor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN edit_count INTEGER NOT NULL DEFAULT 0;
+
+UPDATE posts SET last_editor_id = author_id;
+
+-- Прежние версии постов. Каждая строка - версия, которую заменила правка:
+-- ее текст, кто ее написал и когда она появилась
+CREATE TABLE post_revisions (
+    id SERIAL PRIMARY KEY,
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    content TEXT NOT NULL,
+    editor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    UNIQUE (post_id, version)
+);
+
+INSERT INTO permissions (name, description, privileged) VALUES
+    ('post.history.read', 'View edit history of posts', FALSE),
+    ('post.revision.restore', 'Restore old revisions of posts', TRUE);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('user', 'post.history.read'),
+    ('moderator', 'post.history.read'),
+    ('admin', 'post.history.read'),
+    ('moderator', 'post.revision.restore'),
+    ('admin', 'post.revision.restore');
+
+-- +goose Down
+DELETE FROM permissions WHERE name IN ('post.history.read', 'post.revision.restore');
+DROP TABLE IF EXISTS post_revisions;
+ALTER TABLE posts
+    DROP COLUMN IF EXISTS edit_count,
+    DROP COLUMN IF EXISTS last_editor_id;
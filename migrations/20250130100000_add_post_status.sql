@@ -0,0 +1,31 @@
+-- +goose Up
+
+-- Черновики видит только автор, запланированные посты публикует фоновый
+-- publisher, когда наступает publish_at. Хэштеги и упоминания у
+-- неопубликованных постов не связываются. При публикации created_at
+-- переставляется на момент публикации, чтобы пост занял свое место в лентах.
+CREATE TYPE post_status AS ENUM ('draft', 'scheduled', 'published');
+
+ALTER TABLE posts
+    ADD COLUMN status post_status NOT NULL DEFAULT 'published',
+    ADD COLUMN publish_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_posts_scheduled ON posts(publish_at) WHERE status = 'scheduled';
+CREATE INDEX idx_posts_unpublished ON posts(author_id) WHERE status <> 'published';
+
+INSERT INTO permissions (name, description, privileged) VALUES
+    ('post.publish', 'Schedule and publish own drafts', FALSE);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('user', 'post.publish'),
+    ('moderator', 'post.publish'),
+    ('admin', 'post.publish');
+
+-- +goose Down
+DELETE FROM permissions WHERE name = 'post.publish';
+DROP INDEX IF EXISTS idx_posts_unpublished;
+DROP INDEX IF EXISTS idx_posts_scheduled;
+ALTER TABLE posts
+    DROP COLUMN IF EXISTS publish_at,
+    DROP COLUMN IF EXISTS status;
+DROP TYPE IF EXISTS post_status;
@@ -0,0 +1,28 @@
+-- +goose Up
+
+-- Вложения постов. Файлы лежат в blob-хранилище, здесь только метаданные.
+-- Сначала файл загружается без поста, затем прикрепляется при создании
+-- поста. Строки без поста (не прикрепленные или от удаленных постов)
+-- подчищает фоновая задача вместе с файлами, поэтому ссылки на пост и
+-- владельца при удалении обнуляются, а не удаляют строку.
+CREATE TABLE media (
+    id SERIAL PRIMARY KEY,
+    public_id VARCHAR(32) UNIQUE NOT NULL,
+    owner_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    post_id INTEGER REFERENCES posts(id) ON DELETE SET NULL,
+    position SMALLINT,
+    kind VARCHAR(10) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    width INTEGER,
+    height INTEGER,
+    blob_key TEXT NOT NULL,
+    thumbnail_key TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_media_post ON media(post_id, position);
+CREATE INDEX idx_media_orphans ON media(created_at) WHERE post_id IS NULL;
+
+-- +goose Down
+DROP TABLE IF EXISTS media;
@@ -0,0 +1,53 @@
+-- +goose Up
+
+-- Опросы. К посту прикрепляется не больше одного опроса.
+CREATE TABLE polls (
+    id SERIAL PRIMARY KEY,
+    post_id INTEGER UNIQUE NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    multiple_choice BOOLEAN NOT NULL DEFAULT FALSE,
+    closes_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE poll_options (
+    id SERIAL PRIMARY KEY,
+    poll_id INTEGER NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+    position SMALLINT NOT NULL,
+    text VARCHAR(100) NOT NULL,
+    UNIQUE (poll_id, position)
+);
+
+-- Голос пользователя. Первичный ключ не дает проголосовать дважды,
+-- выбранные варианты (при множественном выборе их несколько) лежат
+-- в poll_vote_options.
+CREATE TABLE poll_votes (
+    poll_id INTEGER NOT NULL REFERENCES polls(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (poll_id, user_id)
+);
+
+CREATE TABLE poll_vote_options (
+    poll_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    option_id INTEGER NOT NULL REFERENCES poll_options(id) ON DELETE CASCADE,
+    PRIMARY KEY (poll_id, user_id, option_id),
+    FOREIGN KEY (poll_id, user_id) REFERENCES poll_votes(poll_id, user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_poll_vote_options_option ON poll_vote_options(option_id);
+
+INSERT INTO permissions (name, description, privileged) VALUES
+    ('poll.vote', 'Vote in polls', FALSE);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('user', 'poll.vote'),
+    ('moderator', 'poll.vote'),
+    ('admin', 'poll.vote');
+
+-- +goose Down
+DELETE FROM permissions WHERE name = 'poll.vote';
+DROP TABLE IF EXISTS poll_vote_options;
+DROP TABLE IF EXISTS poll_votes;
+DROP TABLE IF EXISTS poll_options;
+DROP TABLE IF EXISTS polls;
@@ -0,0 +1,20 @@
+-- +goose Up
+
+-- Кому виден пост: всем, подписчикам автора или только упомянутым
+-- пользователям. Автор видит свои посты всегда.
+CREATE TYPE post_visibility AS ENUM ('public', 'followers', 'mentioned');
+
+ALTER TABLE posts ADD COLUMN visibility post_visibility NOT NULL DEFAULT 'public';
+
+INSERT INTO permissions (name, description, privileged) VALUES
+    ('post.visibility', 'Change visibility of own posts', FALSE);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('user', 'post.visibility'),
+    ('moderator', 'post.visibility'),
+    ('admin', 'post.visibility');
+
+-- +goose Down
+DELETE FROM permissions WHERE name = 'post.visibility';
+ALTER TABLE posts DROP COLUMN IF EXISTS visibility;
+DROP TYPE IF EXISTS post_visibility;
@@ -0,0 +1,37 @@
+-- +goose Up
+
+-- Закладки видны только владельцу, поэтому счетчиков по ним нигде нет.
+-- Закладка удаляется вместе с постом, а при удалении подборки остается
+-- без подборки.
+CREATE TABLE bookmark_collections (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE bookmarks (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    collection_id INTEGER REFERENCES bookmark_collections(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, post_id)
+);
+
+CREATE INDEX idx_bookmarks_user ON bookmarks(user_id, created_at);
+CREATE INDEX idx_bookmarks_collection ON bookmarks(collection_id, created_at);
+CREATE INDEX idx_bookmarks_post ON bookmarks(post_id);
+
+INSERT INTO permissions (name, description, privileged) VALUES
+    ('bookmark.manage', 'Bookmark posts and manage bookmark collections', FALSE);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('user', 'bookmark.manage'),
+    ('moderator', 'bookmark.manage'),
+    ('admin', 'bookmark.manage');
+
+-- +goose Down
+DELETE FROM permissions WHERE name = 'bookmark.manage';
+DROP TABLE IF EXISTS bookmarks;
+DROP TABLE IF EXISTS bookmark_collections;
@@ -0,0 +1,26 @@
+-- +goose Up
+
+-- Закрепленные посты профиля, не больше трех на автора (проверяет
+-- приложение). Закрепить можно только опубликованный публичный пост,
+-- смена видимости снимает закрепление.
+ALTER TABLE posts
+    ADD COLUMN pinned_at TIMESTAMP WITH TIME ZONE,
+    ADD CONSTRAINT posts_pinned_public
+        CHECK (pinned_at IS NULL OR (status = 'published' AND visibility = 'public'));
+
+CREATE INDEX idx_posts_pinned ON posts(author_id, pinned_at) WHERE pinned_at IS NOT NULL;
+
+INSERT INTO permissions (name, description, privileged) VALUES
+    ('post.pin', 'Pin own posts on the profile', FALSE);
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('user', 'post.pin'),
+    ('moderator', 'post.pin'),
+    ('admin', 'post.pin');
+
+-- +goose Down
+DELETE FROM permissions WHERE name = 'post.pin';
+DROP INDEX IF EXISTS idx_posts_pinned;
+ALTER TABLE posts
+    DROP CONSTRAINT IF EXISTS posts_pinned_public,
+    DROP COLUMN IF EXISTS pinned_at;
@@ -0,0 +1,14 @@
+-- +goose Up
+
+-- Полнотекстовый поиск. Текст разбирается обеими конфигурациями: русской
+-- и английской, поэтому поиск находит словоформы на обоих языках.
+-- Колонка вычисляемая и обновляется вместе с content.
+ALTER TABLE posts ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    to_tsvector('russian', content) || to_tsvector('english', content)
+) STORED;
+
+CREATE INDEX idx_posts_search ON posts USING GIN (search_vector);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_posts_search;
+ALTER TABLE posts DROP COLUMN IF EXISTS search_vector;
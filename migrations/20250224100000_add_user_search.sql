@@ -0,0 +1,13 @@
+-- +goose Up
+
+-- Поиск пользователей: триграммный индекс для нечеткого совпадения и
+-- btree для автодополнения по коротким префиксам, где триграммы не помогают
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX idx_users_username_trgm ON users USING GIN (lower(username) gin_trgm_ops);
+CREATE INDEX idx_users_username_prefix ON users (lower(username) text_pattern_ops);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_users_username_prefix;
+DROP INDEX IF EXISTS idx_users_username_trgm;
+DROP EXTENSION IF EXISTS pg_trgm;
@@ -0,0 +1,25 @@
+-- +goose Up
+
+-- Тренды хэштегов. Таблицу целиком пересчитывает фоновая задача, ручка
+-- трендов читает только ее и не сканирует post_hashtags.
+-- window_name - окно ('1h', '24h', '7d'), uses - использования в окне,
+-- baseline - сколько использований ожидалось за окно по предыдущему
+-- периоду, score - насколько хэштег обгоняет эту норму.
+CREATE TABLE hashtag_trends (
+    window_name VARCHAR(8) NOT NULL,
+    hashtag_id INTEGER NOT NULL REFERENCES hashtags(id) ON DELETE CASCADE,
+    uses INTEGER NOT NULL,
+    baseline DOUBLE PRECISION NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    computed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (window_name, hashtag_id)
+);
+
+CREATE INDEX idx_hashtag_trends_score ON hashtag_trends(window_name, score DESC);
+
+-- Агрегация выбирает посты за период
+CREATE INDEX idx_posts_created_at ON posts(created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_posts_created_at;
+DROP TABLE IF EXISTS hashtag_trends;